@@ -0,0 +1,285 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	"github.com/fission/keda-connectors/common"
+
+	"go.uber.org/zap"
+)
+
+type pullFunc func(*record) error
+type record struct {
+	*types.Record
+	shardID            string
+	millisBehindLatest *int64
+}
+type awsKinesisConnector struct {
+	// PauseGate stops the shard scans while the connector is paused
+	common.PauseGate
+	ctx           context.Context
+	client        *kinesis.Client
+	connectordata common.ConnectorMetadata
+	logger        *zap.Logger
+	shardc        chan *types.Shard
+	maxRecords    int32
+}
+
+// listShards get called every 30sec to get all the shards
+func (conn *awsKinesisConnector) listShards(ctx context.Context) ([]types.Shard, error) {
+	// call DescribeStream to get updated shards
+	stream, err := conn.client.DescribeStream(ctx, &kinesis.DescribeStreamInput{
+		StreamName: &conn.connectordata.Topic,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stream.StreamDescription.Shards, nil
+}
+
+// findNewShards sends shards, it only sends newly added shards
+func (conn *awsKinesisConnector) findNewShards() {
+	var shards sync.Map
+	var ticker = time.NewTicker(30 * time.Second)
+	for {
+		select {
+		case <-conn.ctx.Done():
+			ticker.Stop()
+			return
+		case <-ticker.C:
+			// check if new shards are available in every 30 seconds
+			shardList, err := conn.listShards(conn.ctx)
+			if err != nil {
+				return
+			}
+
+			for _, s := range shardList {
+				// send only new shards
+				_, loaded := shards.LoadOrStore(*s.ShardId, s)
+				if !loaded {
+					conn.shardc <- &s
+				}
+			}
+		}
+	}
+}
+
+// getIterator get's the iterator either from start or from where we left
+func (conn *awsKinesisConnector) getIterator(shardID string, checkpoint string) (*kinesis.GetShardIteratorOutput, error) {
+	params := &kinesis.GetShardIteratorInput{
+		ShardId:    &shardID,
+		StreamName: &conn.connectordata.Topic,
+	}
+
+	if checkpoint != "" {
+		// Start from, where we left
+		params.StartingSequenceNumber = aws.String(checkpoint)
+		params.ShardIteratorType = types.ShardIteratorTypeAfterSequenceNumber
+		iteratorOutput, err := conn.client.GetShardIterator(conn.ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		return iteratorOutput, err
+	}
+	// Start from, oldest record in the shard
+	params.ShardIteratorType = types.ShardIteratorTypeTrimHorizon
+	iteratorOutput, err := conn.client.GetShardIterator(conn.ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return iteratorOutput, err
+}
+
+// getRecords get the data for the specific shard
+func (conn *awsKinesisConnector) getRecords(ctx context.Context, shardIterator *string) (*kinesis.GetRecordsOutput, error) {
+	// get records use shard iterator for making request
+	records, err := conn.client.GetRecords(ctx, &kinesis.GetRecordsInput{
+		ShardIterator: shardIterator,
+		Limit:         &conn.maxRecords,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Check if shards are closed, shards can be updated by using update-shard-count method
+func isShardClosed(nextShardIterator, currentShardIterator *string) bool {
+	// No new iterator is present, means it is closed
+	return nextShardIterator == nil || currentShardIterator == nextShardIterator
+}
+
+// scan each shards for any new records, when found call the passed func
+func (conn *awsKinesisConnector) pullRecords(fn pullFunc) {
+	// checkpoints to identify how much read has happened
+	var checkpoints sync.Map
+	var wg sync.WaitGroup
+	// get called when any new shards are added
+	for s := range conn.shardc {
+		// Start fresh
+		checkpoints.Store(*s.ShardId, "")
+		wg.Add(1)
+		go func(shardID string) {
+			defer wg.Done()
+			// scan every 10 second
+			scanTicker := time.NewTicker(10 * time.Second)
+			defer scanTicker.Stop()
+			for {
+				// block while the connector is paused
+				if err := conn.Wait(conn.ctx); err != nil {
+					return
+				}
+				// do noting if shard got deleted
+				checkpoint, found := checkpoints.Load(shardID)
+				if !found {
+					conn.logger.Info("shard not found", zap.String("shardID", shardID))
+					return
+				}
+				iteratorOutput, err := conn.getIterator(shardID, checkpoint.(string))
+				if err != nil {
+					conn.logger.Error("error in iterator",
+						zap.String("shardID", shardID),
+						zap.Error(err))
+					return
+				}
+				iterator := iteratorOutput.ShardIterator
+				if iterator != nil {
+					resp, err := conn.getRecords(conn.ctx, iterator)
+					if err != nil {
+						conn.logger.Error("error in getting records",
+							zap.String("shardID", shardID),
+							zap.Error(err))
+						return
+					}
+
+					for _, r := range resp.Records {
+						// send records
+						err := fn(&record{&r, shardID, resp.MillisBehindLatest})
+						checkpoints.Store(shardID, *r.SequenceNumber)
+						if err != nil {
+							conn.logger.Error("error in processing records",
+								zap.String("shardID", shardID),
+								zap.Error(err))
+						}
+					}
+					if isShardClosed(resp.NextShardIterator, iterator) {
+						// when shards got deleted, remove it from checkpoints
+						if _, found := checkpoints.Load(shardID); found {
+							checkpoints.Delete(shardID)
+							return
+						}
+					}
+				}
+				select {
+				case <-conn.ctx.Done():
+					return
+				case <-scanTicker.C:
+					continue
+				}
+			}
+
+		}(*s.ShardId)
+	}
+	wg.Wait()
+}
+
+// kinesisMessage is a record read from a shard
+type kinesisMessage struct {
+	*record
+	headers http.Header
+}
+
+func (m *kinesisMessage) Body() []byte         { return m.Data }
+func (m *kinesisMessage) Headers() http.Header { return m.headers }
+func (m *kinesisMessage) Key() string          { return aws.ToString(m.PartitionKey) }
+
+// Position returns the shard and the sequence number of the record
+func (m *kinesisMessage) Position() map[string]string {
+	return map[string]string{
+		"shardId":        m.shardID,
+		"sequenceNumber": aws.ToString(m.SequenceNumber),
+	}
+}
+
+// Ack is a no-op, the shard checkpoint advances past every record that was handled
+func (m *kinesisMessage) Ack() error {
+	return nil
+}
+
+// Nack is a no-op, the shard checkpoint advances past every record that was handled
+func (m *kinesisMessage) Nack() error {
+	return nil
+}
+
+// Consume reads the records of all shards of the stream until ctx is cancelled or the
+// shards can no longer be listed
+func (conn *awsKinesisConnector) Consume(ctx context.Context, handler common.MessageHandler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	conn.ctx = ctx
+
+	headers := common.KEDAHeaders(conn.connectordata)
+
+	// Get the shards in shardc chan
+	go func() {
+		conn.findNewShards()
+		cancel()
+		close(conn.shardc)
+	}()
+
+	conn.pullRecords(func(r *record) error {
+		handler(ctx, &kinesisMessage{record: r, headers: headers.Clone()})
+		return nil // continue pulling
+	})
+	return nil
+}
+
+// Command runs the AWS Kinesis connector
+var Command = common.Command{
+	Name:        "kinesis",
+	Description: "Read records from an AWS Kinesis data stream and post them to an HTTP endpoint",
+	Run:         Run,
+	Headers:     common.KEDAHeaders,
+}
+
+// Run reads records from all shards of the configured stream until ctx is cancelled
+func Run(ctx context.Context, logger *zap.Logger, connectordata common.ConnectorMetadata) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	config, err := common.GetAwsConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch aws config: %w", err)
+	}
+
+	kc := kinesis.NewFromConfig(config)
+	waiter := kinesis.NewStreamExistsWaiter(kc)
+	if err := waiter.Wait(ctx, &kinesis.DescribeStreamInput{StreamName: &connectordata.Topic}, 5*time.Minute); err != nil {
+		return fmt.Errorf("not able to connect to kinesis stream: %w", err)
+	}
+
+	pipeline, err := common.NewPipeline(ctx, logger, connectordata, &kinesisSink{client: kc})
+	if err != nil {
+		return err
+	}
+	defer pipeline.Close()
+
+	conn := awsKinesisConnector{
+		client:        kc,
+		connectordata: connectordata,
+		logger:        logger,
+		shardc:        make(chan *types.Shard, 1),
+		maxRecords:    10, // Read maximum 10 records
+	}
+	common.RegisterPausable(&conn)
+	logger.Info("Starting aws kinesis connector")
+	return conn.Consume(ctx, pipeline.Handle)
+}
@@ -0,0 +1,64 @@
+package connector
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+func init() {
+	common.RegisterSink("kinesis", newKinesisSinkFromURL)
+}
+
+// kinesisSink puts records to the stream named by the message topic
+type kinesisSink struct {
+	client *kinesis.Client
+}
+
+// newKinesisSinkFromURL creates a sink from the URL kinesis://, the region and
+// credentials are taken from the AWS configuration of the connector
+func newKinesisSinkFromURL(ctx context.Context, _ *url.URL, _ common.ConnectorMetadata, _ *zap.Logger) (common.Sink, error) {
+	config, err := common.GetAwsConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &kinesisSink{client: kinesis.NewFromConfig(config)}, nil
+}
+
+func (s *kinesisSink) Publish(ctx context.Context, msg common.SinkMessage) error {
+	_, err := s.client.PutRecord(ctx, &kinesis.PutRecordInput{
+		Data:         msg.Body,
+		PartitionKey: aws.String(partitionKey(msg)),
+		StreamName:   aws.String(msg.Topic),
+	})
+	return err
+}
+
+// MaxMessageSize returns the 1 MiB limit of Kinesis for the data and partition key of a record
+func (s *kinesisSink) MaxMessageSize() int {
+	return 1024 * 1024
+}
+
+// Size counts the data and partition key of the record, Kinesis records have no headers
+func (s *kinesisSink) Size(msg common.SinkMessage) int {
+	return len(msg.Body) + len(partitionKey(msg))
+}
+
+// partitionKey returns the partition key of the record of msg. It is required, so messages
+// without a key get a random one and are spread across shards.
+func partitionKey(msg common.SinkMessage) string {
+	if msg.Key == "" {
+		return xid.New().String()
+	}
+	return msg.Key
+}
+
+func (s *kinesisSink) Close() error {
+	return nil
+}
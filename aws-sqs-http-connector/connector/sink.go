@@ -0,0 +1,96 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+func init() {
+	common.RegisterSink("sqs", newSQSSinkFromURL)
+}
+
+// sqsSink sends messages to the queue named by the message topic
+type sqsSink struct {
+	sqsURL    *url.URL
+	sqsClient *sqs.Client
+}
+
+// newSQSSinkFromURL creates a sink from a URL of the form sqs://sqs.<region>.amazonaws.com/<account_id>,
+// queues are resolved relative to it. Set insecure=true to use http, e.g. for localstack.
+func newSQSSinkFromURL(ctx context.Context, u *url.URL, _ common.ConnectorMetadata, _ *zap.Logger) (common.Sink, error) {
+	config, err := common.GetAwsConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "https"
+	if u.Query().Get("insecure") == "true" {
+		scheme = "http"
+	}
+	sqsURL := &url.URL{
+		Scheme: scheme,
+		Host:   u.Host,
+		Path:   strings.TrimSuffix(u.Path, "/") + "/",
+	}
+	return &sqsSink{sqsURL: sqsURL, sqsClient: sqs.NewFromConfig(config)}, nil
+}
+
+func (s *sqsSink) Publish(ctx context.Context, msg common.SinkMessage) error {
+	queueURL, err := parseURL(s.sqsURL, msg.Topic)
+	if err != nil {
+		return err
+	}
+	body := string(msg.Body)
+	_, err = s.sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		DelaySeconds:      int32(10),
+		MessageAttributes: messageAttributes(msg.Headers),
+		MessageBody:       &body,
+		QueueUrl:          &queueURL,
+	})
+	return err
+}
+
+// MaxMessageSize returns the 256 KiB limit of SQS for the body and attributes of a message
+func (s *sqsSink) MaxMessageSize() int {
+	return 256 * 1024
+}
+
+// Size counts the body and attributes of the message, with their names and data types. The
+// key is not sent to SQS.
+func (s *sqsSink) Size(msg common.SinkMessage) int {
+	size := len(msg.Body)
+	for name, value := range messageAttributes(msg.Headers) {
+		size += len(name) + len(aws.ToString(value.DataType)) + len(aws.ToString(value.StringValue))
+	}
+	return size
+}
+
+func (s *sqsSink) Close() error {
+	return nil
+}
+
+// messageAttributes converts HTTP headers to SQS message attributes
+func messageAttributes(headers http.Header) map[string]types.MessageAttributeValue {
+	if len(headers) == 0 {
+		return nil
+	}
+	var sqsMessageAttValue = make(map[string]types.MessageAttributeValue)
+	for k, v := range headers {
+		for _, d := range v {
+			sqsMessageAttValue[k] = types.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(d),
+			}
+		}
+	}
+	return sqsMessageAttValue
+}
@@ -0,0 +1,173 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"net/http"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+type awsSQSConnector struct {
+	// PauseGate stops the polling loop while the connector is paused
+	common.PauseGate
+	sqsURL        *url.URL
+	sqsClient     *sqs.Client
+	connectordata common.ConnectorMetadata
+	logger        *zap.Logger
+}
+
+func parseURL(baseURL *url.URL, queueName string) (string, error) {
+	u, err := url.Parse(queueName)
+	if err != nil {
+		return "", err
+	}
+	consQueueURL := baseURL.ResolveReference(u)
+	return consQueueURL.String(), nil
+}
+
+// sqsMessage is a message received from the consumer queue
+type sqsMessage struct {
+	ctx      context.Context
+	conn     *awsSQSConnector
+	message  types.Message
+	queueURL string
+	headers  http.Header
+}
+
+func (m *sqsMessage) Body() []byte         { return []byte(*m.message.Body) }
+func (m *sqsMessage) Headers() http.Header { return m.headers }
+func (m *sqsMessage) Key() string {
+	return m.message.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)]
+}
+
+// Position returns the queue and the id of the message
+func (m *sqsMessage) Position() map[string]string {
+	return map[string]string{
+		"queueUrl":  m.queueURL,
+		"messageId": aws.ToString(m.message.MessageId),
+	}
+}
+
+// Ack deletes the message from the queue
+func (m *sqsMessage) Ack() error {
+	return m.conn.deleteMessage(m.ctx, *m.message.ReceiptHandle, m.queueURL)
+}
+
+// Nack keeps the message in the queue, it becomes visible again once its visibility timeout expires
+func (m *sqsMessage) Nack() error {
+	return nil
+}
+
+// Consume receives messages from the consumer queue until ctx is cancelled
+func (conn *awsSQSConnector) Consume(ctx context.Context, handler common.MessageHandler) error {
+	var maxNumberOfMessages = int32(10) // Process maximum 10 messages concurrently
+	var waitTimeSeconds = int32(5)      // Wait 5 sec to process another message
+	headers := common.KEDAHeaders(conn.connectordata)
+
+	consQueueURL, err := parseURL(conn.sqsURL, conn.connectordata.Topic)
+	if err != nil {
+		return fmt.Errorf("failed to parse consumer queue url: %w", err)
+	}
+
+	conn.logger.Info("starting to consume messages from queue", zap.String("queue", consQueueURL), zap.String("response topic", conn.connectordata.ResponseTopic), zap.String("error topic", conn.connectordata.ErrorTopic))
+
+	for {
+		if err := conn.Wait(ctx); err != nil {
+			return nil
+		}
+		output, err := conn.sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            &consQueueURL,
+			MaxNumberOfMessages: maxNumberOfMessages,
+			WaitTimeSeconds:     waitTimeSeconds,
+			// The message group of FIFO queues is the key of the message
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameMessageGroupId},
+		})
+
+		if err != nil {
+			// check if context was cancelled, signaling that the consumer should stop
+			if ctx.Err() != nil {
+				return nil
+			}
+			conn.logger.Error("failed to fetch sqs message", zap.Error(err))
+			continue
+		}
+
+		for _, message := range output.Messages {
+			msgHeaders := headers.Clone()
+			// Set the attributes as message header came from SQS record
+			for k, v := range message.Attributes {
+				msgHeaders.Add(k, v)
+			}
+
+			handler(ctx, &sqsMessage{
+				ctx:      ctx,
+				conn:     conn,
+				message:  message,
+				queueURL: consQueueURL,
+				headers:  msgHeaders,
+			})
+		}
+	}
+}
+
+func (conn *awsSQSConnector) deleteMessage(ctx context.Context, id string, queueURL string) error {
+	_, err := conn.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      &queueURL,
+		ReceiptHandle: &id,
+	})
+
+	if err != nil {
+		return fmt.Errorf("delete Error: %w", err)
+	}
+
+	conn.logger.Info("message deleted")
+	return nil
+}
+
+// Command runs the AWS SQS connector
+var Command = common.Command{
+	Name:        "sqs",
+	Description: "Receive messages from an AWS SQS queue and post them to an HTTP endpoint",
+	Run:         Run,
+	Headers:     common.KEDAHeaders,
+}
+
+// Run receives messages from the configured queue until ctx is cancelled
+func Run(ctx context.Context, logger *zap.Logger, connectordata common.ConnectorMetadata) error {
+	config, err := common.GetAwsConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch aws config: %w", err)
+	}
+	svc := sqs.NewFromConfig(config)
+
+	sqsURL, err := url.Parse(strings.TrimSuffix(os.Getenv("QUEUE_URL"), os.Getenv("TOPIC")))
+	if err != nil {
+		return fmt.Errorf("not able parse aws sqs url: %w", err)
+	}
+
+	pipeline, err := common.NewPipeline(ctx, logger, connectordata, &sqsSink{sqsURL: sqsURL, sqsClient: svc})
+	if err != nil {
+		return err
+	}
+	defer pipeline.Close()
+
+	conn := awsSQSConnector{
+		sqsURL:        sqsURL,
+		sqsClient:     svc,
+		connectordata: connectordata,
+		logger:        logger,
+	}
+	common.RegisterPausable(&conn)
+	return conn.Consume(ctx, pipeline.Handle)
+}
@@ -0,0 +1,316 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type (
+	// Pausable is implemented by sources which can stop and restart consuming without
+	// being shut down
+	Pausable interface {
+		// Pause stops the delivery of new messages, messages already delivered are still handled
+		Pause() error
+		// Resume restarts the delivery of messages
+		Resume() error
+	}
+
+	// ConnectorStatus is returned by the admin API
+	ConnectorStatus struct {
+		Ready    bool     `json:"ready"`
+		Paused   bool     `json:"paused"`
+		Healthy  bool     `json:"healthy"`
+		Problems []string `json:"problems,omitempty"`
+		// InFlight counts the messages being handled and the deliveries to secondary endpoints
+		// still running in the background
+		InFlight        int        `json:"inFlight"`
+		LastMessageTime *time.Time `json:"lastMessageTime,omitempty"`
+	}
+
+	// connectorState tracks the state of the connector running in this process
+	connectorState struct {
+		mu          sync.Mutex
+		source      Pausable
+		paused      bool
+		inFlight    int
+		lastMessage time.Time
+		// problems are the reasons the connector is unhealthy
+		problems []string
+		// idle is closed and replaced whenever inFlight drops to zero
+		idle chan struct{}
+	}
+)
+
+var (
+	errNotReady = errors.New("connector is not consuming yet")
+
+	state = &connectorState{idle: make(chan struct{})}
+)
+
+// RegisterPausable makes the source of the connector available to the admin API
+func RegisterPausable(source Pausable) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.source = source
+}
+
+// ReportUnhealthy marks the connector as unhealthy, e.g. when it stopped consuming part of
+// its source. It is reported by the admin API until the connector is restarted or the
+// problem is cleared with ClearUnhealthy.
+func ReportUnhealthy(reason string) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.problems = append(state.problems, reason)
+}
+
+// ClearUnhealthy removes a problem reported with ReportUnhealthy once it has gone away
+func ClearUnhealthy(reason string) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.problems = slices.DeleteFunc(state.problems, func(problem string) bool {
+		return problem == reason
+	})
+}
+
+func (s *connectorState) pause() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.source == nil {
+		return errNotReady
+	}
+	if s.paused {
+		return nil
+	}
+	if err := s.source.Pause(); err != nil {
+		return err
+	}
+	s.paused = true
+	return nil
+}
+
+func (s *connectorState) resume() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.source == nil {
+		return errNotReady
+	}
+	if !s.paused {
+		return nil
+	}
+	if err := s.source.Resume(); err != nil {
+		return err
+	}
+	s.paused = false
+	return nil
+}
+
+// messageStarted is called by the pipeline before a message is handled
+func (s *connectorState) messageStarted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight++
+	s.lastMessage = time.Now()
+}
+
+// deliveryStarted is called before a delivery which continues in the background once its
+// message has been handled, e.g. to a secondary endpoint. It ends with messageDone.
+func (s *connectorState) deliveryStarted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight++
+}
+
+// messageDone is called by the pipeline once a message has been acknowledged
+func (s *connectorState) messageDone() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	if s.inFlight == 0 {
+		close(s.idle)
+		s.idle = make(chan struct{})
+	}
+}
+
+// waitIdle blocks until no message is in flight or ctx is done
+func (s *connectorState) waitIdle(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		if s.inFlight == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		idle := s.idle
+		s.mu.Unlock()
+
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *connectorState) status() ConnectorStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := ConnectorStatus{
+		Ready:    s.source != nil,
+		Paused:   s.paused,
+		Healthy:  len(s.problems) == 0,
+		Problems: append([]string(nil), s.problems...),
+		InFlight: s.inFlight,
+	}
+	if !s.lastMessage.IsZero() {
+		lastMessage := s.lastMessage
+		status.LastMessageTime = &lastMessage
+	}
+	return status
+}
+
+// ServeAdmin serves the admin API until ctx is cancelled:
+//
+//	POST /pause   stops consuming new messages
+//	POST /resume  restarts consuming
+//	POST /drain   pauses and waits until in-flight messages are done, bounded by ?timeout=30s
+//	GET  /status  returns the ConnectorStatus
+//	GET  /healthz returns the ConnectorStatus, with status 503 when the connector is unhealthy
+func ServeAdmin(ctx context.Context, address string, logger *zap.Logger) error {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           adminHandler(logger),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// adminHandler routes the requests of the admin API
+func adminHandler(logger *zap.Logger) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		if err := state.pause(); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		logger.Info("connector paused by admin API")
+		writeStatus(w, http.StatusOK)
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		if err := state.resume(); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		logger.Info("connector resumed by admin API")
+		writeStatus(w, http.StatusOK)
+	})
+	mux.HandleFunc("POST /drain", func(w http.ResponseWriter, r *http.Request) {
+		timeout := 30 * time.Second
+		if t := r.URL.Query().Get("timeout"); t != "" {
+			var err error
+			timeout, err = time.ParseDuration(t)
+			if err != nil {
+				http.Error(w, "invalid timeout: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := state.pause(); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		logger.Info("connector draining by admin API", zap.Duration("timeout", timeout))
+
+		drainCtx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		if err := state.waitIdle(drainCtx); err != nil {
+			// Still paused, the caller can poll /status until the messages are done
+			writeStatus(w, http.StatusAccepted)
+			return
+		}
+		writeStatus(w, http.StatusOK)
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, http.StatusOK)
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		if !state.status().Healthy {
+			writeStatus(w, http.StatusServiceUnavailable)
+			return
+		}
+		writeStatus(w, http.StatusOK)
+	})
+	return mux
+}
+
+func writeStatus(w http.ResponseWriter, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(state.status())
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if errors.Is(err, errNotReady) {
+		code = http.StatusServiceUnavailable
+	}
+	http.Error(w, err.Error(), code)
+}
+
+// PauseGate implements Pausable for polling loops, which call Wait before fetching messages
+type PauseGate struct {
+	mu sync.Mutex
+	// resumed is non-nil while paused and closed on Resume
+	resumed chan struct{}
+}
+
+// Pause makes Wait block until Resume is called
+func (g *PauseGate) Pause() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed == nil {
+		g.resumed = make(chan struct{})
+	}
+	return nil
+}
+
+// Resume releases the loops blocked in Wait
+func (g *PauseGate) Resume() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed != nil {
+		close(g.resumed)
+		g.resumed = nil
+	}
+	return nil
+}
+
+// Wait blocks while the gate is paused, it returns ctx.Err() if ctx is done first
+func (g *PauseGate) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+	if resumed == nil {
+		return ctx.Err()
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
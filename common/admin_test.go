@@ -0,0 +1,196 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeSource counts the calls of the admin API
+type fakeSource struct {
+	pauses  int
+	resumes int
+	err     error
+}
+
+func (s *fakeSource) Pause() error {
+	s.pauses++
+	return s.err
+}
+
+func (s *fakeSource) Resume() error {
+	s.resumes++
+	return s.err
+}
+
+// resetState gives the test a connector state of its own
+func resetState(t *testing.T) {
+	t.Helper()
+	previous := state
+	state = &connectorState{idle: make(chan struct{})}
+	t.Cleanup(func() { state = previous })
+}
+
+// adminRequest sends a request to the admin API and decodes the returned status
+func adminRequest(t *testing.T, method, target string) (int, ConnectorStatus) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	adminHandler(zap.NewNop()).ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	var status ConnectorStatus
+	if rec.Header().Get("Content-Type") == "application/json" {
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+			t.Fatalf("invalid status %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec.Code, status
+}
+
+func TestAdminPauseResume(t *testing.T) {
+	resetState(t)
+	if code, _ := adminRequest(t, http.MethodPost, "/pause"); code != http.StatusServiceUnavailable {
+		t.Errorf("pause before the source is registered returned %d", code)
+	}
+
+	source := &fakeSource{}
+	RegisterPausable(source)
+	for range 2 {
+		code, status := adminRequest(t, http.MethodPost, "/pause")
+		if code != http.StatusOK || !status.Paused || !status.Ready {
+			t.Errorf("pause returned %d with %+v", code, status)
+		}
+	}
+	if source.pauses != 1 {
+		t.Errorf("source paused %d times, want once", source.pauses)
+	}
+
+	code, status := adminRequest(t, http.MethodPost, "/resume")
+	if code != http.StatusOK || status.Paused || source.resumes != 1 {
+		t.Errorf("resume returned %d with %+v after %d resumes", code, status, source.resumes)
+	}
+	if code, _ := adminRequest(t, http.MethodGet, "/pause"); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /pause returned %d", code)
+	}
+}
+
+func TestAdminPauseFailure(t *testing.T) {
+	resetState(t)
+	RegisterPausable(&fakeSource{err: errors.New("consumer group closed")})
+	code, _ := adminRequest(t, http.MethodPost, "/pause")
+	if code != http.StatusInternalServerError {
+		t.Errorf("failed pause returned %d", code)
+	}
+	if state.status().Paused {
+		t.Error("connector reported paused after the source failed to pause")
+	}
+}
+
+func TestAdminDrain(t *testing.T) {
+	tests := []struct {
+		name string
+		// done is how long the message in flight takes, it never finishes when zero
+		done  time.Duration
+		query string
+		code  int
+	}{
+		{name: "idle", code: http.StatusOK},
+		{name: "message finishes", done: 20 * time.Millisecond, query: "?timeout=5s", code: http.StatusOK},
+		{name: "timeout", query: "?timeout=20ms", code: http.StatusAccepted},
+		{name: "invalid timeout", query: "?timeout=soon", code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetState(t)
+			source := &fakeSource{}
+			RegisterPausable(source)
+			if tt.name != "idle" {
+				state.messageStarted()
+				if tt.done > 0 {
+					time.AfterFunc(tt.done, state.messageDone)
+				}
+			}
+
+			code, status := adminRequest(t, http.MethodPost, "/drain"+tt.query)
+			if code != tt.code {
+				t.Fatalf("drain returned %d, want %d", code, tt.code)
+			}
+			if code == http.StatusBadRequest {
+				return
+			}
+			if !status.Paused || source.pauses != 1 {
+				t.Errorf("drain left the connector with %+v", status)
+			}
+			wantInFlight := 0
+			if code == http.StatusAccepted {
+				wantInFlight = 1
+			}
+			if status.InFlight != wantInFlight {
+				t.Errorf("%d messages in flight, want %d", status.InFlight, wantInFlight)
+			}
+		})
+	}
+}
+
+func TestAdminHealthz(t *testing.T) {
+	resetState(t)
+	if code, status := adminRequest(t, http.MethodGet, "/healthz"); code != http.StatusOK || !status.Healthy {
+		t.Errorf("healthy connector returned %d with %+v", code, status)
+	}
+
+	ReportUnhealthy("partition orders/0 stopped")
+	code, status := adminRequest(t, http.MethodGet, "/healthz")
+	if code != http.StatusServiceUnavailable || status.Healthy || len(status.Problems) != 1 {
+		t.Errorf("unhealthy connector returned %d with %+v", code, status)
+	}
+	if code, _ := adminRequest(t, http.MethodGet, "/status"); code != http.StatusOK {
+		t.Errorf("status of an unhealthy connector returned %d", code)
+	}
+
+	ClearUnhealthy("partition orders/0 stopped")
+	if code, status := adminRequest(t, http.MethodGet, "/healthz"); code != http.StatusOK || len(status.Problems) != 0 {
+		t.Errorf("cleared connector returned %d with %+v", code, status)
+	}
+}
+
+func TestAdminLastMessageTime(t *testing.T) {
+	resetState(t)
+	if _, status := adminRequest(t, http.MethodGet, "/status"); status.LastMessageTime != nil {
+		t.Errorf("last message time %v before any message", status.LastMessageTime)
+	}
+	state.messageStarted()
+	state.messageDone()
+	if _, status := adminRequest(t, http.MethodGet, "/status"); status.LastMessageTime == nil || status.InFlight != 0 {
+		t.Errorf("status %+v after a message", status)
+	}
+}
+
+func TestPauseGate(t *testing.T) {
+	var gate PauseGate
+	if err := gate.Wait(context.Background()); err != nil {
+		t.Fatalf("open gate: %v", err)
+	}
+
+	_ = gate.Pause()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := gate.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("paused gate returned %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- gate.Wait(context.Background()) }()
+	_ = gate.Resume()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("resumed gate returned %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait still blocked after Resume")
+	}
+}
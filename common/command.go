@@ -0,0 +1,163 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+type (
+	// RunFunc consumes messages from the source until ctx is cancelled or an unrecoverable error occurs
+	RunFunc func(ctx context.Context, logger *zap.Logger, connectordata ConnectorMetadata) error
+
+	// Command describes a connector which can be started either as its own binary or as a
+	// subcommand of the multi-source keda-connector binary
+	Command struct {
+		Name        string
+		Description string
+		Run         RunFunc
+		// Headers returns the headers the connector sends to the function with every
+		// message, before the headers of the message itself are added
+		Headers func(connectordata ConnectorMetadata) http.Header
+	}
+
+	// commandOptions contains the flags shared by every connector
+	commandOptions struct {
+		metricsAddress string
+		adminAddress   string
+	}
+)
+
+// replayCommand is the subcommand of the multi-source binary replaying recorded messages
+const replayCommand = "replay"
+
+// Main is the entrypoint of single connector binaries. It parses the shared flags,
+// sets up logging, metrics and signal handling and runs the connector.
+func Main(cmd Command) {
+	os.Exit(runCommand(cmd, cmd.Name, os.Args[1:]))
+}
+
+// Execute is the entrypoint of the multi-source binary. The first argument selects
+// the connector to run, remaining arguments are parsed as shared flags.
+func Execute(name string, cmds ...Command) {
+	byName := make(map[string]Command, len(cmds))
+	for _, cmd := range cmds {
+		byName[cmd.Name] = cmd
+	}
+
+	if len(os.Args) < 2 {
+		printUsage(os.Stderr, name, byName)
+		os.Exit(2)
+	}
+
+	sub := os.Args[1]
+	if sub == "help" || sub == "-h" || sub == "-help" || sub == "--help" {
+		printUsage(os.Stdout, name, byName)
+		os.Exit(0)
+	}
+
+	if sub == replayCommand {
+		os.Exit(runReplay(name+" "+replayCommand, os.Args[2:], byName))
+	}
+
+	cmd, ok := byName[sub]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown connector %q\n\n", sub)
+		printUsage(os.Stderr, name, byName)
+		os.Exit(2)
+	}
+	os.Exit(runCommand(cmd, name+" "+cmd.Name, os.Args[2:]))
+}
+
+func printUsage(w io.Writer, name string, cmds map[string]Command) {
+	names := make([]string, 0, len(cmds))
+	for n := range cmds {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "Usage: %s <connector> [flags]\n\nConnectors:\n", name)
+	for _, n := range names {
+		fmt.Fprintf(w, "  %-16s %s\n", n, cmds[n].Description)
+	}
+	fmt.Fprintf(w, "\nCommands:\n  %-16s %s\n", replayCommand, "Send recorded messages to the function like a connector would")
+	fmt.Fprintf(w, "\nRun '%s <connector> -h' for the shared flags.\n", name)
+}
+
+// parseFlags parses the flags shared by all connectors. Every flag falls back to an
+// environment variable so existing deployments keep working without arguments.
+func parseFlags(name string, args []string) (commandOptions, error) {
+	opts := commandOptions{}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&opts.metricsAddress, "metrics-address", os.Getenv("METRICS_ADDRESS"), "address to serve metrics on, e.g. :8080. Disabled when empty (env METRICS_ADDRESS)")
+	fs.StringVar(&opts.adminAddress, "admin-address", os.Getenv("ADMIN_ADDRESS"), "address to serve the pause/resume/drain admin API on, e.g. localhost:8081. Disabled when empty (env ADMIN_ADDRESS)")
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if fs.NArg() > 0 {
+		return opts, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	return opts, nil
+}
+
+func runCommand(cmd Command, name string, args []string) int {
+	opts, err := parseFlags(name, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	logger, err := NewLogger()
+	if err != nil {
+		log.Printf("can't initialize zap logger: %v", err)
+		return 1
+	}
+	defer func() {
+		_ = logger.Sync()
+	}()
+	logger = logger.With(zap.String("connector", cmd.Name))
+
+	connectordata, err := ParseConnectorMetadata()
+	if err != nil {
+		logger.Error("failed to parse connector metadata", zap.Error(err))
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if opts.metricsAddress != "" {
+		go func() {
+			if err := ServeMetrics(ctx, opts.metricsAddress); err != nil {
+				logger.Error("metrics server failed", zap.Error(err), zap.String("address", opts.metricsAddress))
+			}
+		}()
+	}
+
+	if opts.adminAddress != "" {
+		go func() {
+			if err := ServeAdmin(ctx, opts.adminAddress, logger); err != nil {
+				logger.Error("admin server failed", zap.Error(err), zap.String("address", opts.adminAddress))
+			}
+		}()
+	}
+
+	if err := cmd.Run(ctx, logger, connectordata); err != nil && !errors.Is(err, context.Canceled) {
+		logger.Error("connector stopped with error", zap.Error(err))
+		return 1
+	}
+	logger.Info("connector stopped")
+	return 0
+}
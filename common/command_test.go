@@ -0,0 +1,76 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrintUsage(t *testing.T) {
+	cmds := map[string]Command{
+		"sqs":   {Name: "sqs", Description: "Consume SQS"},
+		"kafka": {Name: "kafka", Description: "Consume Kafka"},
+	}
+	var out strings.Builder
+	printUsage(&out, "keda-connector", cmds)
+
+	usage := out.String()
+	kafka, sqs := strings.Index(usage, "kafka "), strings.Index(usage, "sqs ")
+	if kafka < 0 || sqs < 0 || kafka > sqs {
+		t.Errorf("connectors not listed in order:\n%s", usage)
+	}
+	for _, want := range []string{"Usage: keda-connector <connector>", "Consume Kafka", replayCommand} {
+		if !strings.Contains(usage, want) {
+			t.Errorf("usage does not contain %q:\n%s", want, usage)
+		}
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		metrics string
+		admin   string
+		err     bool
+	}{
+		{name: "defaults"},
+		{
+			name:    "environment",
+			env:     map[string]string{"METRICS_ADDRESS": ":8080", "ADMIN_ADDRESS": "localhost:8081"},
+			metrics: ":8080",
+			admin:   "localhost:8081",
+		},
+		{
+			name:    "flags override the environment",
+			env:     map[string]string{"METRICS_ADDRESS": ":8080"},
+			args:    []string{"-metrics-address", ":9090", "-admin-address", ":9091"},
+			metrics: ":9090",
+			admin:   ":9091",
+		},
+		{name: "unknown flag", args: []string{"-topic", "orders"}, err: true},
+		{name: "unexpected argument", args: []string{"orders"}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("METRICS_ADDRESS", "")
+			t.Setenv("ADMIN_ADDRESS", "")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			opts, err := parseFlags("test", tt.args)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if opts.metricsAddress != tt.metrics || opts.adminAddress != tt.admin {
+				t.Errorf("metrics address %q and admin address %q, want %q and %q", opts.metricsAddress, opts.adminAddress, tt.metrics, tt.admin)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultEjectAfter    = 3
+	defaultEjectDuration = 30 * time.Second
+)
+
+type (
+	// EndpointSet is a group of endpoints serving the same function, e.g. the blue and green
+	// deployments of a function. Every invocation is sent to one member chosen by weight, and
+	// fails over to the other members when the chosen one cannot be connected to. Members
+	// failing to connect repeatedly are ejected for a cool-down period.
+	EndpointSet struct {
+		spec          string
+		members       []*endpointMember
+		ejectAfter    int
+		ejectDuration time.Duration
+
+		mu sync.Mutex
+	}
+
+	endpointMember struct {
+		url    string
+		weight int
+		// failures counts consecutive connection errors
+		failures     int
+		ejectedUntil time.Time
+	}
+)
+
+// parseEndpointsEnv returns the endpoints messages are sent to. HTTP_ENDPOINT is a single URL
+// used as is, since URLs can contain commas, and HTTP_ENDPOINTS lists several endpoint sets.
+func parseEndpointsEnv() (string, []*EndpointSet, error) {
+	single, list := os.Getenv("HTTP_ENDPOINT"), os.Getenv("HTTP_ENDPOINTS")
+	switch {
+	case single != "" && list != "":
+		return "", nil, errors.New("only one of HTTP_ENDPOINT and HTTP_ENDPOINTS can be set")
+	case list != "":
+		sets, err := parseHTTPEndpoints(list)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to parse HTTP_ENDPOINTS: %w", err)
+		}
+		if len(sets) == 0 {
+			return "", nil, errors.New("no endpoint given in HTTP_ENDPOINTS")
+		}
+		return list, sets, nil
+	case single != "":
+		if err := validateEndpointTemplate(single); err != nil {
+			return "", nil, fmt.Errorf("failed to parse HTTP_ENDPOINT: %w", err)
+		}
+		return single, []*EndpointSet{singleEndpointSet(single)}, nil
+	}
+	return "", nil, errors.New("environment variable not found: HTTP_ENDPOINT")
+}
+
+// singleEndpointSet returns the endpoint set of a single URL
+func singleEndpointSet(url string) *EndpointSet {
+	return &EndpointSet{
+		spec:    url,
+		members: []*endpointMember{{url: url, weight: 1}},
+	}
+}
+
+// parseHTTPEndpoints parses the comma separated endpoint sets of HTTP_ENDPOINTS
+func parseHTTPEndpoints(raw string) ([]*EndpointSet, error) {
+	ejectAfter, ejectDuration, err := parseEjectSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	var sets []*EndpointSet
+	for _, spec := range strings.Split(raw, ",") {
+		if spec = strings.TrimSpace(spec); spec == "" {
+			continue
+		}
+		set, err := ParseEndpointSet(spec, ejectAfter, ejectDuration)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	return sets, nil
+}
+
+// parseEjectSettings reads the ejection of endpoint set members, they are ejected after
+// ENDPOINT_EJECT_AFTER consecutive connection errors for ENDPOINT_EJECT_DURATION
+func parseEjectSettings() (int, time.Duration, error) {
+	ejectAfter := defaultEjectAfter
+	if v := os.Getenv("ENDPOINT_EJECT_AFTER"); v != "" {
+		var err error
+		ejectAfter, err = strconv.Atoi(v)
+		if err != nil || ejectAfter < 0 {
+			return 0, 0, fmt.Errorf("ENDPOINT_EJECT_AFTER must be a number of connection errors, got %q", v)
+		}
+	}
+	ejectDuration := defaultEjectDuration
+	if v := os.Getenv("ENDPOINT_EJECT_DURATION"); v != "" {
+		var err error
+		ejectDuration, err = time.ParseDuration(v)
+		if err != nil || ejectDuration <= 0 {
+			return 0, 0, fmt.Errorf("ENDPOINT_EJECT_DURATION must be a positive duration, got %q", v)
+		}
+	}
+	return ejectAfter, ejectDuration, nil
+}
+
+// ParseEndpointSet parses an endpoint set of members separated by |, each with an optional
+// weight, e.g. http://blue;weight=90|http://green;weight=10. Weights default to 1, members
+// with a weight of 0 only receive invocations when failing over.
+func ParseEndpointSet(spec string, ejectAfter int, ejectDuration time.Duration) (*EndpointSet, error) {
+	set := &EndpointSet{
+		spec:          spec,
+		ejectAfter:    ejectAfter,
+		ejectDuration: ejectDuration,
+	}
+	total := 0
+	for _, member := range strings.Split(spec, "|") {
+		url, weightParam, hasWeight := strings.Cut(strings.TrimSpace(member), ";weight=")
+		if url == "" {
+			return nil, fmt.Errorf("empty endpoint in %q", spec)
+		}
+		if err := validateEndpointTemplate(url); err != nil {
+			return nil, err
+		}
+		weight := 1
+		if hasWeight {
+			var err error
+			weight, err = strconv.Atoi(weightParam)
+			if err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid weight %q of endpoint %s", weightParam, url)
+			}
+		}
+		total += weight
+		set.members = append(set.members, &endpointMember{url: url, weight: weight})
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("at least one endpoint of %q must have a weight greater than 0", spec)
+	}
+	return set, nil
+}
+
+// String returns the endpoint set as configured
+func (s *EndpointSet) String() string {
+	return s.spec
+}
+
+// order returns the members in the order they are tried for an invocation: a healthy member
+// chosen by weight first, then the other healthy members by decreasing weight, and the
+// ejected members last in case none of the others can be reached either
+func (s *EndpointSet) order() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var healthy, ejected []*endpointMember
+	total := 0
+	for _, m := range s.members {
+		if now.Before(m.ejectedUntil) {
+			ejected = append(ejected, m)
+			continue
+		}
+		healthy = append(healthy, m)
+		total += m.weight
+	}
+
+	sortByWeight := func(members []*endpointMember) {
+		sort.SliceStable(members, func(i, j int) bool { return members[i].weight > members[j].weight })
+	}
+	sortByWeight(healthy)
+	sortByWeight(ejected)
+
+	// Move the member chosen by weight to the front
+	if total > 0 {
+		n := rand.IntN(total)
+		for i, m := range healthy {
+			if n < m.weight {
+				copy(healthy[1:i+1], healthy[:i])
+				healthy[0] = m
+				break
+			}
+			n -= m.weight
+		}
+	}
+
+	urls := make([]string, 0, len(s.members))
+	for _, m := range append(healthy, ejected...) {
+		urls = append(urls, m.url)
+	}
+	return urls
+}
+
+// succeeded records that url could be connected to
+func (s *EndpointSet) succeeded(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m := s.member(url); m != nil {
+		m.failures = 0
+		m.ejectedUntil = time.Time{}
+	}
+}
+
+// failed records a connection error of url and reports whether it got ejected
+func (s *EndpointSet) failed(url string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.member(url)
+	if m == nil || len(s.members) == 1 {
+		return false
+	}
+	m.failures++
+	if s.ejectAfter > 0 && m.failures >= s.ejectAfter {
+		m.failures = 0
+		m.ejectedUntil = time.Now().Add(s.ejectDuration)
+		return true
+	}
+	return false
+}
+
+func (s *EndpointSet) member(url string) *endpointMember {
+	for _, m := range s.members {
+		if m.url == url {
+			return m
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestParseEndpointSet(t *testing.T) {
+	tests := []struct {
+		spec    string
+		urls    []string
+		weights []int
+		err     bool
+	}{
+		{spec: "http://blue", urls: []string{"http://blue"}, weights: []int{1}},
+		{spec: "http://blue;weight=90|http://green;weight=10", urls: []string{"http://blue", "http://green"}, weights: []int{90, 10}},
+		{spec: " http://blue | http://green;weight=0 ", urls: []string{"http://blue", "http://green"}, weights: []int{1, 0}},
+		{spec: "http://blue|", err: true},
+		{spec: "http://blue;weight=-1", err: true},
+		{spec: "http://blue;weight=heavy", err: true},
+		{spec: "http://blue;weight=0|http://green;weight=0", err: true},
+		{spec: "http://fn/{}", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			set, err := ParseEndpointSet(tt.spec, 1, time.Minute)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var urls []string
+			var weights []int
+			for _, m := range set.members {
+				urls = append(urls, m.url)
+				weights = append(weights, m.weight)
+			}
+			if !slices.Equal(urls, tt.urls) || !slices.Equal(weights, tt.weights) {
+				t.Errorf("members %v with weights %v, want %v with weights %v", urls, weights, tt.urls, tt.weights)
+			}
+		})
+	}
+}
+
+func TestParseHTTPEndpointsEjection(t *testing.T) {
+	tests := []struct {
+		name          string
+		after         string
+		duration      string
+		ejectAfter    int
+		ejectDuration time.Duration
+		err           bool
+	}{
+		{name: "defaults", ejectAfter: defaultEjectAfter, ejectDuration: defaultEjectDuration},
+		{name: "configured", after: "5", duration: "1m", ejectAfter: 5, ejectDuration: time.Minute},
+		{name: "never ejected", after: "0", ejectAfter: 0, ejectDuration: defaultEjectDuration},
+		{name: "negative errors", after: "-1", err: true},
+		{name: "zero duration", duration: "0s", err: true},
+		{name: "negative duration", duration: "-30s", err: true},
+		{name: "invalid duration", duration: "soon", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENDPOINT_EJECT_AFTER", tt.after)
+			t.Setenv("ENDPOINT_EJECT_DURATION", tt.duration)
+			sets, err := parseHTTPEndpoints("http://a|http://b, http://c")
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(sets) != 2 || sets[0].String() != "http://a|http://b" {
+				t.Fatalf("endpoint sets %v", sets)
+			}
+			for _, set := range sets {
+				if set.ejectAfter != tt.ejectAfter || set.ejectDuration != tt.ejectDuration {
+					t.Errorf("set %s ejected after %d errors for %v, want %d for %v", set, set.ejectAfter, set.ejectDuration, tt.ejectAfter, tt.ejectDuration)
+				}
+			}
+		})
+	}
+}
+
+func TestEndpointSetEjection(t *testing.T) {
+	set, err := ParseEndpointSet("http://blue;weight=1|http://green;weight=0", 2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		// action is failed or succeeded, applied to url
+		action  string
+		url     string
+		ejected bool
+		order   []string
+	}{
+		{order: []string{"http://blue", "http://green"}},
+		{action: "failed", url: "http://blue", order: []string{"http://blue", "http://green"}},
+		// A success resets the consecutive failures
+		{action: "succeeded", url: "http://blue", order: []string{"http://blue", "http://green"}},
+		{action: "failed", url: "http://blue", order: []string{"http://blue", "http://green"}},
+		{action: "failed", url: "http://blue", ejected: true, order: []string{"http://green", "http://blue"}},
+		// Ejected members recover once they can be connected to again
+		{action: "succeeded", url: "http://blue", order: []string{"http://blue", "http://green"}},
+		{action: "failed", url: "http://unknown", order: []string{"http://blue", "http://green"}},
+	}
+	for i, step := range steps {
+		var ejected bool
+		switch step.action {
+		case "failed":
+			ejected = set.failed(step.url)
+		case "succeeded":
+			set.succeeded(step.url)
+		}
+		if ejected != step.ejected {
+			t.Errorf("step %d: ejected %v, want %v", i, ejected, step.ejected)
+		}
+		if order := set.order(); !slices.Equal(order, step.order) {
+			t.Errorf("step %d: order %v, want %v", i, order, step.order)
+		}
+	}
+}
+
+func TestEndpointSetEjectionExpires(t *testing.T) {
+	set, err := ParseEndpointSet("http://blue;weight=1|http://green;weight=0", 1, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !set.failed("http://blue") {
+		t.Fatal("member not ejected after a failure")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if order := set.order(); order[0] != "http://blue" {
+		t.Errorf("order %v after the ejection expired, want http://blue first", order)
+	}
+}
+
+func TestSingleEndpointIsNeverEjected(t *testing.T) {
+	set, err := ParseEndpointSet("http://blue", 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if set.failed("http://blue") {
+			t.Fatal("the only member of a set was ejected")
+		}
+	}
+}
+
+func TestInvokeEndpointRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		calls    int32
+		err      bool
+	}{
+		{name: "success", statuses: []int{200}, calls: 1},
+		{name: "success after retries", statuses: []int{500, 503, 200}, retries: 2, calls: 3},
+		{name: "retries exhausted", statuses: []int{500, 500, 200}, retries: 1, calls: 2, err: true},
+		{name: "status 300 is a failure", statuses: []int{300}, calls: 1, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				call := calls.Add(1)
+				w.WriteHeader(tt.statuses[call-1])
+			}))
+			defer srv.Close()
+
+			data := ConnectorMetadata{MaxRetries: tt.retries}
+			resp, err := invokeEndpoint(context.Background(), []byte("message"), http.Header{}, singleEndpointSet(srv.URL), data, zap.NewNop())
+			if calls.Load() != tt.calls {
+				t.Errorf("function invoked %d times, want %d", calls.Load(), tt.calls)
+			}
+			if tt.err {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("expected an error")
+				}
+				var details FunctionErrorDetails
+				if jsonErr := json.Unmarshal([]byte(err.Error()), &details); jsonErr != nil || details.FunctionHTTPResponse.StatusCode != tt.statuses[tt.calls-1] {
+					t.Errorf("error %v does not report the last response", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+		})
+	}
+}
+
+func TestInvokeEndpointFailover(t *testing.T) {
+	srv := statusServer(t, http.StatusOK)
+	// Nothing listens on the first member, connections to it are refused
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	set, err := ParseEndpointSet(down.URL+";weight=1|"+srv+";weight=0", 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := invokeEndpoint(context.Background(), []byte("message"), http.Header{}, set, ConnectorMetadata{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("no failover to the second member: %v", err)
+	}
+	resp.Body.Close()
+	if order := set.order(); order[0] != srv {
+		t.Errorf("member refusing connections not ejected, order %v", order)
+	}
+}
@@ -0,0 +1,251 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Delivery policies selected by DELIVERY_POLICY when HTTP_ENDPOINTS lists several endpoints
+const (
+	// DeliveryPolicyAll succeeds when every endpoint succeeds
+	DeliveryPolicyAll = "all"
+	// DeliveryPolicyAny succeeds when at least one endpoint succeeds
+	DeliveryPolicyAny = "any"
+	// DeliveryPolicyPrimary succeeds when the first endpoint succeeds, the other
+	// endpoints are delivered to on a best-effort basis
+	DeliveryPolicyPrimary = "primary"
+)
+
+const (
+	defaultSecondaryTimeout     = time.Minute
+	defaultSecondaryMaxInFlight = 100
+)
+
+// FunctionEndpointResult is the outcome of the invocation of one of the endpoints a
+// message was fanned out to
+type FunctionEndpointResult struct {
+	HTTPEndpoint string
+	StatusCode   int
+	ResponseBody string `json:",omitempty"`
+	ErrorString  string `json:",omitempty"`
+}
+
+// parseSecondaryTimeout reads from SECONDARY_TIMEOUT how long the secondary endpoints of the
+// primary policy are delivered to
+func parseSecondaryTimeout() (time.Duration, error) {
+	v := os.Getenv("SECONDARY_TIMEOUT")
+	if v == "" {
+		return defaultSecondaryTimeout, nil
+	}
+	timeout, err := time.ParseDuration(v)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("SECONDARY_TIMEOUT must be a positive duration, got %q", v)
+	}
+	return timeout, nil
+}
+
+// parseSecondaryMaxInFlight reads from SECONDARY_MAX_IN_FLIGHT how many deliveries to the
+// secondary endpoints of the primary policy can run in the background at once
+func parseSecondaryMaxInFlight() (int, error) {
+	v := os.Getenv("SECONDARY_MAX_IN_FLIGHT")
+	if v == "" {
+		return defaultSecondaryMaxInFlight, nil
+	}
+	max, err := strconv.Atoi(v)
+	if err != nil || max <= 0 {
+		return 0, fmt.Errorf("SECONDARY_MAX_IN_FLIGHT must be a positive number, got %q", v)
+	}
+	return max, nil
+}
+
+// secondaryDeliveries bounds the background deliveries to the secondary endpoints of the
+// primary delivery policy
+type secondaryDeliveries struct {
+	slots chan struct{}
+}
+
+func newSecondaryDeliveries(max int) *secondaryDeliveries {
+	return &secondaryDeliveries{slots: make(chan struct{}, max)}
+}
+
+// start takes a slot for a delivery, it returns false when every slot is taken. Deliveries
+// are not bounded when s is nil, i.e. for metadata not read from the environment.
+func (s *secondaryDeliveries) start() bool {
+	if s == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// done releases the slot of a delivery
+func (s *secondaryDeliveries) done() {
+	if s != nil {
+		<-s.slots
+	}
+}
+
+func parseDeliveryPolicy(policy string) (string, error) {
+	switch policy {
+	case "":
+		return DeliveryPolicyAll, nil
+	case DeliveryPolicyAll, DeliveryPolicyAny, DeliveryPolicyPrimary:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid DELIVERY_POLICY %q, must be one of %s, %s or %s", policy, DeliveryPolicyAll, DeliveryPolicyAny, DeliveryPolicyPrimary)
+	}
+}
+
+// fanOut sends message to all endpoints concurrently and decides the outcome according to
+// the delivery policy. The response of the first endpoint is returned, or with the any policy
+// the response of the first endpoint which succeeded. The error envelope of a failed delivery
+// holds the result of every endpoint.
+func fanOut(ctx context.Context, message []byte, headers http.Header, endpoints []*EndpointSet, data ConnectorMetadata, logger *zap.Logger) (*http.Response, error) {
+	if data.DeliveryPolicy == DeliveryPolicyPrimary {
+		return deliverPrimary(ctx, message, headers, endpoints, data, logger)
+	}
+
+	type outcome struct {
+		resp *http.Response
+		err  error
+	}
+	outcomes := make([]outcome, len(endpoints))
+
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := invokeEndpoint(ctx, message, headers, endpoint, data, logger)
+			outcomes[i] = outcome{resp: resp, err: err}
+		}()
+	}
+	wg.Wait()
+
+	// chosen is the index of the response returned to the caller, -1 if the delivery failed
+	chosen := -1
+	switch data.DeliveryPolicy {
+	case DeliveryPolicyAny:
+		for i, o := range outcomes {
+			if o.err == nil {
+				chosen = i
+				break
+			}
+		}
+	default:
+		chosen = 0
+		for _, o := range outcomes {
+			if o.err != nil {
+				chosen = -1
+				break
+			}
+		}
+	}
+
+	// Only the chosen response is handed to the caller, the others are closed here
+	for i, o := range outcomes {
+		if i != chosen && o.resp != nil {
+			if err := o.resp.Body.Close(); err != nil {
+				logger.Error("failed to close response body", zap.Error(err), zap.String("http_endpoint", endpoints[i].String()))
+			}
+		}
+	}
+	if chosen >= 0 {
+		return outcomes[chosen].resp, nil
+	}
+
+	errResp := NewFunctionErrorDetails(string(message), data.HTTPEndpoint, headers)
+	failed := 0
+	for i, o := range outcomes {
+		if o.err == nil {
+			errResp.Endpoints = append(errResp.Endpoints, FunctionEndpointResult{
+				HTTPEndpoint: endpoints[i].String(),
+				StatusCode:   o.resp.StatusCode,
+			})
+			continue
+		}
+		result := endpointResult(endpoints[i].String(), o.err)
+		errResp.Endpoints = append(errResp.Endpoints, result)
+		if failed == 0 {
+			// The first failure in endpoint order is reported as the response
+			errResp.FunctionHTTPResponse.StatusCode = result.StatusCode
+			errResp.FunctionHTTPResponse.ResponseBody = result.ResponseBody
+		}
+		failed++
+	}
+	errResp.FunctionHTTPResponse.ErrorString = fmt.Sprintf("delivery policy %s not met, %d of %d endpoints failed. http_endpoint: %s, source: %s",
+		data.DeliveryPolicy, failed, len(endpoints), data.HTTPEndpoint, data.SourceName)
+
+	errorBytes, err := json.Marshal(errResp)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshalling error response. http_endpoint: %s, source: %s", data.HTTPEndpoint, data.SourceName)
+	}
+	return nil, errors.New(string(errorBytes))
+}
+
+// deliverPrimary returns the outcome of the first endpoint as soon as it is known. The other
+// endpoints are delivered to in the background for at most data.SecondaryTimeout, their
+// failures are only logged. Deliveries beyond SECONDARY_MAX_IN_FLIGHT are skipped.
+func deliverPrimary(ctx context.Context, message []byte, headers http.Header, endpoints []*EndpointSet, data ConnectorMetadata, logger *zap.Logger) (*http.Response, error) {
+	for _, endpoint := range endpoints[1:] {
+		if !data.secondaries.start() {
+			logger.Warn("too many deliveries to secondary endpoints in flight, skipping delivery",
+				zap.String("http_endpoint", endpoint.String()),
+				zap.String("source", data.SourceName))
+			continue
+		}
+		// The delivery is in flight until it is done, so that draining the connector waits for it
+		state.deliveryStarted()
+		// The caller may modify the headers once the primary endpoint returned
+		headers := headers.Clone()
+		go func() {
+			defer state.messageDone()
+			defer data.secondaries.done()
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), data.SecondaryTimeout)
+			defer cancel()
+			resp, err := invokeEndpoint(ctx, message, headers, endpoint, data, logger)
+			if err != nil {
+				logger.Warn("delivery to secondary endpoint failed",
+					zap.String("http_endpoint", endpoint.String()),
+					zap.String("source", data.SourceName),
+					zap.String("function_error", endpointResult(endpoint.String(), err).ErrorString))
+				return
+			}
+			if err := resp.Body.Close(); err != nil {
+				logger.Error("failed to close response body", zap.Error(err), zap.String("http_endpoint", endpoint.String()))
+			}
+		}()
+	}
+	return invokeEndpoint(ctx, message, headers, endpoints[0], data, logger)
+}
+
+// endpointResult converts the error returned by invokeEndpoint into the result of the endpoint
+func endpointResult(endpoint string, err error) FunctionEndpointResult {
+	details, ok := parseFunctionErrorDetails(err)
+	if !ok {
+		return FunctionEndpointResult{
+			HTTPEndpoint: endpoint,
+			StatusCode:   http.StatusInternalServerError,
+			ErrorString:  err.Error(),
+		}
+	}
+	return FunctionEndpointResult{
+		HTTPEndpoint: endpoint,
+		StatusCode:   details.FunctionHTTPResponse.StatusCode,
+		ResponseBody: details.FunctionHTTPResponse.ResponseBody,
+		ErrorString:  details.FunctionHTTPResponse.ErrorString,
+	}
+}
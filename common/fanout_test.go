@@ -0,0 +1,221 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestParseEndpointsEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		endpoints string
+		sets      []string
+		err       bool
+	}{
+		{name: "single endpoint with a comma", endpoint: "http://fn?ids=1,2", sets: []string{"http://fn?ids=1,2"}},
+		{name: "endpoint list", endpoints: "http://a, http://b,", sets: []string{"http://a", "http://b"}},
+		{name: "both set", endpoint: "http://a", endpoints: "http://b", err: true},
+		{name: "empty list", endpoints: " , ", err: true},
+		{name: "none set", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HTTP_ENDPOINT", tt.endpoint)
+			t.Setenv("HTTP_ENDPOINTS", tt.endpoints)
+			_, sets, err := parseEndpointsEnv()
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var specs []string
+			for _, set := range sets {
+				specs = append(specs, set.String())
+			}
+			if !slices.Equal(specs, tt.sets) {
+				t.Errorf("endpoint sets %v, want %v", specs, tt.sets)
+			}
+		})
+	}
+}
+
+func TestParseFanOutSettings(t *testing.T) {
+	if policy, err := parseDeliveryPolicy(""); err != nil || policy != DeliveryPolicyAll {
+		t.Errorf("default policy %q, %v", policy, err)
+	}
+	if _, err := parseDeliveryPolicy("majority"); err == nil {
+		t.Error("unknown policy accepted")
+	}
+
+	for _, v := range []string{"0s", "-1m", "soon"} {
+		t.Setenv("SECONDARY_TIMEOUT", v)
+		if _, err := parseSecondaryTimeout(); err == nil {
+			t.Errorf("SECONDARY_TIMEOUT %q accepted", v)
+		}
+	}
+	for _, v := range []string{"0", "-1", "many"} {
+		t.Setenv("SECONDARY_MAX_IN_FLIGHT", v)
+		if _, err := parseSecondaryMaxInFlight(); err == nil {
+			t.Errorf("SECONDARY_MAX_IN_FLIGHT %q accepted", v)
+		}
+	}
+	t.Setenv("SECONDARY_MAX_IN_FLIGHT", "")
+	if max, err := parseSecondaryMaxInFlight(); err != nil || max != defaultSecondaryMaxInFlight {
+		t.Errorf("default SECONDARY_MAX_IN_FLIGHT %d, %v", max, err)
+	}
+}
+
+// statusServer starts a function answering with status and its own URL as body
+func statusServer(t *testing.T, status int) string {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, srv.URL)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestFanOut(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		statuses []int
+		// response is the index of the endpoint whose response is returned, -1 if the delivery fails
+		response int
+	}{
+		{name: "all succeed", policy: DeliveryPolicyAll, statuses: []int{200, 201}, response: 0},
+		{name: "all with a failure", policy: DeliveryPolicyAll, statuses: []int{200, 500}, response: -1},
+		{name: "any with a failure", policy: DeliveryPolicyAny, statuses: []int{500, 200, 202}, response: 1},
+		{name: "any all failing", policy: DeliveryPolicyAny, statuses: []int{500, 404}, response: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var urls []string
+			var sets []*EndpointSet
+			for _, status := range tt.statuses {
+				url := statusServer(t, status)
+				urls = append(urls, url)
+				sets = append(sets, singleEndpointSet(url))
+			}
+			data := ConnectorMetadata{HTTPEndpoints: sets, DeliveryPolicy: tt.policy, SourceName: "test"}
+
+			resp, err := fanOut(context.Background(), []byte("message"), http.Header{}, sets, data, zap.NewNop())
+			if tt.response < 0 {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("expected the delivery to fail")
+				}
+				var details FunctionErrorDetails
+				if jsonErr := json.Unmarshal([]byte(err.Error()), &details); jsonErr != nil {
+					t.Fatalf("error is not an envelope: %v", err)
+				}
+				if len(details.Endpoints) != len(urls) {
+					t.Fatalf("envelope has %d endpoint results, want %d", len(details.Endpoints), len(urls))
+				}
+				for i, result := range details.Endpoints {
+					if result.HTTPEndpoint != urls[i] || result.StatusCode != tt.statuses[i] {
+						t.Errorf("result %d is %+v, want status %d of %s", i, result, tt.statuses[i], urls[i])
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != urls[tt.response] {
+				t.Errorf("response of %s, want %s", body, urls[tt.response])
+			}
+		})
+	}
+}
+
+func TestDeliverPrimary(t *testing.T) {
+	resetState(t)
+	release := make(chan struct{})
+	var secondaryCalls atomic.Int32
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryCalls.Add(1)
+		<-release
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer secondary.Close()
+	defer close(release)
+
+	sets := []*EndpointSet{singleEndpointSet(statusServer(t, http.StatusOK)), singleEndpointSet(secondary.URL)}
+	data := ConnectorMetadata{
+		HTTPEndpoints:    sets,
+		DeliveryPolicy:   DeliveryPolicyPrimary,
+		SecondaryTimeout: time.Minute,
+		secondaries:      newSecondaryDeliveries(1),
+	}
+
+	for range 2 {
+		// The primary response is returned while the secondary endpoint is still delivered to
+		resp, err := fanOut(context.Background(), []byte("message"), http.Header{}, sets, data, zap.NewNop())
+		if err != nil {
+			t.Fatalf("primary delivery failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// The second secondary delivery was skipped since the first one holds the only slot
+	deadline := time.Now().Add(time.Second)
+	for secondaryCalls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if calls := secondaryCalls.Load(); calls != 1 {
+		t.Errorf("secondary endpoint invoked %d times, want once", calls)
+	}
+	if inFlight := state.status().InFlight; inFlight != 1 {
+		t.Errorf("%d deliveries in flight, want the secondary one", inFlight)
+	}
+
+	release <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := state.waitIdle(ctx); err != nil {
+		t.Fatal("secondary delivery still in flight once done")
+	}
+	if !data.secondaries.start() {
+		t.Error("slot of the secondary delivery not released")
+	}
+}
+
+func TestDeliverPrimaryFailure(t *testing.T) {
+	resetState(t)
+	sets := []*EndpointSet{singleEndpointSet(statusServer(t, http.StatusBadGateway)), singleEndpointSet(statusServer(t, http.StatusOK))}
+	data := ConnectorMetadata{
+		HTTPEndpoints:    sets,
+		DeliveryPolicy:   DeliveryPolicyPrimary,
+		SecondaryTimeout: time.Minute,
+		secondaries:      newSecondaryDeliveries(1),
+	}
+	if _, err := fanOut(context.Background(), []byte("message"), http.Header{}, sets, data, zap.NewNop()); err == nil {
+		t.Error("delivery succeeded although the primary endpoint failed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := state.waitIdle(ctx); err != nil {
+		t.Fatal("secondary delivery still in flight")
+	}
+}
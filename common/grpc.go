@@ -0,0 +1,276 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// defaultGRPCMethod is the method invoked when the endpoint URL has no path
+const defaultGRPCMethod = "/keda.connector.v1.Function/Invoke"
+
+const defaultGRPCTimeout = 60 * time.Second
+
+type (
+	// invokeMessage is the InvokeRequest and InvokeResponse of function.proto
+	invokeMessage struct {
+		Payload  []byte
+		Metadata map[string]string
+	}
+
+	// invokeCodec encodes invokeMessage in the protobuf wire format
+	invokeCodec struct{}
+)
+
+var (
+	grpcConnsMu sync.Mutex
+	// grpcConns caches a client connection per target and transport security
+	grpcConns = map[string]*grpc.ClientConn{}
+)
+
+// isGRPCEndpoint reports whether the function behind endpoint is invoked over gRPC
+func isGRPCEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "grpc://") || strings.HasPrefix(endpoint, "grpcs://")
+}
+
+// invokeGRPC invokes the function behind a grpc:// or grpcs:// endpoint, e.g.
+// grpc://host:50051/my.pkg.Service/Invoke. The outcome is converted into an HTTP response
+// so that retries, failover and error handling are the same as for HTTP endpoints. An
+// error is returned when the function could not be reached.
+func invokeGRPC(ctx context.Context, endpoint string, message []byte, headers http.Header, timeout time.Duration) (*http.Response, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse grpc endpoint: %w", err)
+	}
+	method := u.Path
+	if method == "" || method == "/" {
+		method = defaultGRPCMethod
+	}
+
+	conn, err := grpcConn(u.Host, u.Scheme == "grpcs")
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout <= 0 {
+		timeout = defaultGRPCTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req := &invokeMessage{Payload: message, Metadata: map[string]string{}}
+	for key, values := range headers {
+		req.Metadata[key] = strings.Join(values, ",")
+	}
+	resp := &invokeMessage{}
+	err = conn.Invoke(ctx, method, req, resp, grpc.ForceCodec(invokeCodec{}))
+
+	st := status.Convert(err)
+	if st.Code() == codes.Unavailable {
+		// The function could not be reached, which is handled like a connection error
+		return nil, err
+	}
+
+	header := http.Header{}
+	for key, value := range resp.Metadata {
+		header.Set(key, value)
+	}
+	body := resp.Payload
+	if st.Code() != codes.OK {
+		body = []byte(st.Message())
+	}
+	code := grpcHTTPStatus(st.Code())
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}, nil
+}
+
+// parseGRPCTimeout reads the deadline of gRPC invocations from GRPC_TIMEOUT
+func parseGRPCTimeout() (time.Duration, error) {
+	v := os.Getenv("GRPC_TIMEOUT")
+	if v == "" {
+		return defaultGRPCTimeout, nil
+	}
+	timeout, err := time.ParseDuration(v)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("GRPC_TIMEOUT must be a positive duration, got %q", v)
+	}
+	return timeout, nil
+}
+
+func grpcConn(target string, secure bool) (*grpc.ClientConn, error) {
+	key := target
+	creds := insecure.NewCredentials()
+	if secure {
+		key = "tls:" + target
+		creds = credentials.NewTLS(nil)
+	}
+
+	grpcConnsMu.Lock()
+	defer grpcConnsMu.Unlock()
+	if conn, ok := grpcConns[key]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create grpc client: %w", err)
+	}
+	grpcConns[key] = conn
+	return conn, nil
+}
+
+// closeGRPCConns closes the cached client connections, later invocations of gRPC endpoints
+// open new ones
+func closeGRPCConns() error {
+	grpcConnsMu.Lock()
+	defer grpcConnsMu.Unlock()
+	var firstErr error
+	for key, conn := range grpcConns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(grpcConns, key)
+	}
+	return firstErr
+}
+
+// grpcHTTPStatus maps gRPC status codes to the equivalent HTTP status codes
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.OutOfRange, codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Canceled:
+		return 499
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (invokeCodec) Name() string {
+	return "proto"
+}
+
+func (invokeCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(*invokeMessage)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	var b []byte
+	if len(m.Payload) > 0 {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.Payload)
+	}
+
+	// Sorted for a deterministic encoding
+	keys := make([]string, 0, len(m.Metadata))
+	for key := range m.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, key)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, m.Metadata[key])
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b, nil
+}
+
+func (invokeCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(*invokeMessage)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	m.Metadata = map[string]string{}
+	return consumeFields(data, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 1:
+			m.Payload = append([]byte(nil), value...)
+		case 2:
+			var key, val string
+			err := consumeFields(value, func(num protowire.Number, value []byte) error {
+				switch num {
+				case 1:
+					key = string(value)
+				case 2:
+					val = string(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			m.Metadata[key] = val
+		}
+		return nil
+	})
+}
+
+// consumeFields calls fn with the length delimited fields of a protobuf message, other
+// fields are skipped
+func consumeFields(data []byte, fn func(num protowire.Number, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := fn(num, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
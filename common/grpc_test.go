@@ -0,0 +1,216 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestInvokeCodecRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  invokeMessage
+	}{
+		{name: "empty", msg: invokeMessage{Metadata: map[string]string{}}},
+		{name: "payload", msg: invokeMessage{Payload: []byte(`{"id": 1}`), Metadata: map[string]string{}}},
+		{name: "binary payload", msg: invokeMessage{Payload: []byte{0, 0xff, 0x0a}, Metadata: map[string]string{}}},
+		{name: "metadata", msg: invokeMessage{Payload: []byte("a"), Metadata: map[string]string{"keda-topic": "orders", "empty": ""}}},
+	}
+	codec := invokeCodec{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := codec.Marshal(&tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got invokeMessage
+			if err := codec.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Payload, tt.msg.Payload) || !maps.Equal(got.Metadata, tt.msg.Metadata) {
+				t.Errorf("decoded %q with metadata %v, want %q with metadata %v", got.Payload, got.Metadata, tt.msg.Payload, tt.msg.Metadata)
+			}
+		})
+	}
+}
+
+func TestInvokeCodecDeterministic(t *testing.T) {
+	msg := &invokeMessage{Metadata: map[string]string{"c": "3", "a": "1", "b": "2"}}
+	first, err := invokeCodec{}.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 10 {
+		if data, _ := (invokeCodec{}).Marshal(msg); !bytes.Equal(data, first) {
+			t.Fatal("metadata encoded in a different order")
+		}
+	}
+}
+
+func TestInvokeCodecUnmarshal(t *testing.T) {
+	// Fields unknown to the connector are skipped
+	var data []byte
+	data = protowire.AppendTag(data, 3, protowire.VarintType)
+	data = protowire.AppendVarint(data, 7)
+	data = protowire.AppendTag(data, 1, protowire.BytesType)
+	data = protowire.AppendBytes(data, []byte("ok"))
+
+	var msg invokeMessage
+	if err := (invokeCodec{}).Unmarshal(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Payload) != "ok" {
+		t.Errorf("payload %q, want ok", msg.Payload)
+	}
+
+	if err := (invokeCodec{}).Unmarshal([]byte{0x0a, 0x05, 'a'}, &msg); err == nil {
+		t.Error("truncated message decoded without error")
+	}
+	if _, err := (invokeCodec{}).Marshal("payload"); err == nil {
+		t.Error("unexpected type encoded without error")
+	}
+}
+
+func TestGRPCHTTPStatus(t *testing.T) {
+	tests := []struct {
+		code   codes.Code
+		status int
+	}{
+		{codes.OK, http.StatusOK},
+		{codes.InvalidArgument, http.StatusBadRequest},
+		{codes.NotFound, http.StatusNotFound},
+		{codes.ResourceExhausted, http.StatusTooManyRequests},
+		{codes.Unavailable, http.StatusServiceUnavailable},
+		{codes.DeadlineExceeded, http.StatusGatewayTimeout},
+		{codes.Internal, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if status := grpcHTTPStatus(tt.code); status != tt.status {
+			t.Errorf("%s mapped to %d, want %d", tt.code, status, tt.status)
+		}
+	}
+}
+
+// grpcFunction starts a gRPC function echoing the payload of InvokeRequest, or failing with
+// the status code set in the keda-code metadata
+func grpcFunction(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(
+		grpc.ForceServerCodec(invokeCodec{}),
+		grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+			req := &invokeMessage{}
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			if req.Metadata["Keda-Code"] == "not-found" {
+				return status.Error(codes.NotFound, "no such order")
+			}
+			method, _ := grpc.MethodFromServerStream(stream)
+			return stream.SendMsg(&invokeMessage{Payload: req.Payload, Metadata: map[string]string{"method": method}})
+		}))
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+func TestInvokeGRPC(t *testing.T) {
+	t.Cleanup(func() { _ = closeGRPCConns() })
+	address := grpcFunction(t)
+	tests := []struct {
+		name     string
+		endpoint string
+		headers  http.Header
+		status   int
+		body     string
+		method   string
+	}{
+		{name: "default method", endpoint: "grpc://" + address, status: http.StatusOK, body: "order", method: defaultGRPCMethod},
+		{name: "method in path", endpoint: "grpc://" + address + "/orders.Orders/Create", status: http.StatusOK, body: "order", method: "/orders.Orders/Create"},
+		{name: "status error", endpoint: "grpc://" + address, headers: http.Header{"Keda-Code": {"not-found"}}, status: http.StatusNotFound, body: "no such order"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := invokeGRPC(context.Background(), tt.endpoint, []byte("order"), tt.headers, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status || string(body) != tt.body {
+				t.Errorf("status %d with body %q, want %d with %q", resp.StatusCode, body, tt.status, tt.body)
+			}
+			if tt.method != "" && resp.Header.Get("Method") != tt.method {
+				t.Errorf("method %s invoked, want %s", resp.Header.Get("Method"), tt.method)
+			}
+		})
+	}
+}
+
+func TestInvokeGRPCUnavailable(t *testing.T) {
+	t.Cleanup(func() { _ = closeGRPCConns() })
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := lis.Addr().String()
+	lis.Close()
+
+	// An unreachable function is a connection error, so that set members fail over
+	if _, err := invokeGRPC(context.Background(), "grpc://"+address, []byte("order"), nil, time.Second); err == nil {
+		t.Error("unreachable function returned a response")
+	}
+}
+
+func TestCloseGRPCConns(t *testing.T) {
+	conn, err := grpcConn("127.0.0.1:1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached, _ := grpcConn("127.0.0.1:1", false); cached != conn {
+		t.Error("connection not cached")
+	}
+	if secure, _ := grpcConn("127.0.0.1:1", true); secure == conn {
+		t.Error("connection shared by grpc:// and grpcs://")
+	}
+
+	if err := closeGRPCConns(); err != nil {
+		t.Fatal(err)
+	}
+	if conn.GetState() != connectivity.Shutdown {
+		t.Errorf("connection in state %s after closing", conn.GetState())
+	}
+	grpcConnsMu.Lock()
+	defer grpcConnsMu.Unlock()
+	if len(grpcConns) != 0 {
+		t.Errorf("%d connections still cached", len(grpcConns))
+	}
+}
+
+func TestPipelineCloseClosesGRPCConns(t *testing.T) {
+	conn, err := grpcConn("127.0.0.1:1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPipeline(t, ConnectorMetadata{HTTPEndpoint: "grpc://127.0.0.1:1"}, &recordingSink{})
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if conn.GetState() != connectivity.Shutdown {
+		t.Errorf("connection in state %s after the pipeline closed", conn.GetState())
+	}
+}
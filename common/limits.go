@@ -0,0 +1,159 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxPreallocatedBody bounds the buffer allocated up front for a response whose size is not
+// limited by MAX_RESPONSE_SIZE, so that a large Content-Length cannot exhaust the memory
+const maxPreallocatedBody = 64 * 1024
+
+// errResponseTooLarge is returned by readResponseBody when the response exceeds MAX_RESPONSE_SIZE
+var errResponseTooLarge = errors.New("response too large")
+
+// parseMaxResponseSize reads MAX_RESPONSE_SIZE, 0 means unlimited
+func parseMaxResponseSize() (int64, error) {
+	v := os.Getenv("MAX_RESPONSE_SIZE")
+	if v == "" {
+		return 0, nil
+	}
+	size, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("MAX_RESPONSE_SIZE must be a number of bytes, got %q", v)
+	}
+	return size, nil
+}
+
+// Size returns the size of the message with its body, key and headers, which is the size
+// counted against the limits of brokers receiving all of them
+func (msg SinkMessage) Size() int {
+	size := len(msg.Body) + len(msg.Key)
+	for key, values := range msg.Headers {
+		for _, value := range values {
+			size += len(key) + len(value)
+		}
+	}
+	return size
+}
+
+// readResponseBody reads the body of resp, failing with errResponseTooLarge as soon as it
+// exceeds max bytes without reading the rest. max is unlimited when 0.
+func readResponseBody(resp *http.Response, max int64) ([]byte, error) {
+	if max > 0 && resp.ContentLength > max {
+		return nil, errResponseTooLarge
+	}
+
+	// Grow the buffer once when the size is known instead of doubling it while reading. The
+	// Content-Length is only trusted up to MAX_RESPONSE_SIZE.
+	var buf bytes.Buffer
+	if resp.ContentLength > 0 {
+		if max > 0 && resp.ContentLength <= max {
+			buf.Grow(int(resp.ContentLength))
+		} else {
+			buf.Grow(int(min(resp.ContentLength, maxPreallocatedBody)))
+		}
+	}
+	body := io.Reader(resp.Body)
+	if max > 0 {
+		body = io.LimitReader(resp.Body, max+1)
+	}
+	if _, err := buf.ReadFrom(body); err != nil {
+		return nil, err
+	}
+	if max > 0 && int64(buf.Len()) > max {
+		return nil, errResponseTooLarge
+	}
+	return buf.Bytes(), nil
+}
+
+// checkMessageSizes returns an error if any of msgs exceeds the maximum message size of sink
+func checkMessageSizes(sink Sink, msgs []SinkMessage) error {
+	limited, ok := sink.(SizeLimitedSink)
+	if !ok {
+		return nil
+	}
+	max := limited.MaxMessageSize()
+	for _, msg := range msgs {
+		if size := limited.Size(msg); size > max {
+			return fmt.Errorf("response of %d bytes exceeds the maximum message size of %d bytes of the response sink", size, max)
+		}
+	}
+	return nil
+}
+
+// fitErrorEnvelope returns msg, an error envelope, with the request payload and the response
+// bodies it embeds truncated so that it does not exceed the maximum message size of sink.
+// Errors which are not envelopes are truncated as is.
+func fitErrorEnvelope(sink Sink, msg SinkMessage) SinkMessage {
+	limited, ok := sink.(SizeLimitedSink)
+	if !ok || limited.Size(msg) <= limited.MaxMessageSize() {
+		return msg
+	}
+	budget := max(limited.MaxMessageSize()-(limited.Size(msg)-len(msg.Body)), 0)
+
+	var details FunctionErrorDetails
+	if err := json.Unmarshal(msg.Body, &details); err == nil {
+		// Every pass cuts the excess from the largest embedded body, the escaping of JSON can
+		// require a few passes
+		for pass := 0; pass < 8 && len(msg.Body) > budget; pass++ {
+			excess := len(msg.Body) - budget
+			largest := &details.FunctionHTTPRequest.Message
+			if len(details.FunctionHTTPResponse.ResponseBody) > len(*largest) {
+				largest = &details.FunctionHTTPResponse.ResponseBody
+			}
+			for i := range details.Endpoints {
+				if len(details.Endpoints[i].ResponseBody) > len(*largest) {
+					largest = &details.Endpoints[i].ResponseBody
+				}
+			}
+			if len(*largest) == 0 {
+				break
+			}
+			*largest = truncateString(*largest, len(*largest)-excess)
+			if largest == &details.FunctionHTTPRequest.Message {
+				details.FunctionHTTPRequest.Truncated = true
+			}
+			body, err := json.Marshal(details)
+			if err != nil {
+				break
+			}
+			msg.Body = body
+		}
+	}
+	if len(msg.Body) > budget {
+		msg.Body = msg.Body[:budget]
+	}
+	return msg
+}
+
+// truncateString cuts s to at most n bytes without splitting a UTF-8 sequence
+func truncateString(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if n >= len(s) {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+// responseSizeError returns the error envelope of a response which was not published because
+// of its size. The response body is left out of the envelope.
+func responseSizeError(message string, headers http.Header, resp *http.Response, data ConnectorMetadata, reason string) error {
+	errResp := NewFunctionErrorDetails(message, data.HTTPEndpoint, headers)
+	errResp.FunctionHTTPResponse.StatusCode = resp.StatusCode
+	errResp.FunctionHTTPResponse.ErrorString = fmt.Sprintf("%s. http_endpoint: %s, source: %s", reason, data.HTTPEndpoint, data.SourceName)
+	errorBytes, err := json.Marshal(errResp)
+	if err != nil {
+		return fmt.Errorf("failed marshalling error response. http_endpoint: %s, source: %s", data.HTTPEndpoint, data.SourceName)
+	}
+	return errors.New(string(errorBytes))
+}
@@ -0,0 +1,151 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// limitedSink is a sink accepting messages of up to max bytes. The headers of messages are
+// not counted when it is headerless, like for brokers without headers.
+type limitedSink struct {
+	max        int
+	headerless bool
+}
+
+func (s limitedSink) Publish(context.Context, SinkMessage) error { return nil }
+func (s limitedSink) Close() error                               { return nil }
+func (s limitedSink) MaxMessageSize() int                        { return s.max }
+
+func (s limitedSink) Size(msg SinkMessage) int {
+	if s.headerless {
+		return len(msg.Body) + len(msg.Key)
+	}
+	return msg.Size()
+}
+
+func TestReadResponseBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		max           int64
+		tooLarge      bool
+	}{
+		{name: "unlimited", body: "response", contentLength: 8},
+		{name: "within the limit", body: "response", contentLength: 8, max: 8},
+		{name: "over the limit", body: "response", contentLength: -1, max: 7, tooLarge: true},
+		{name: "content length over the limit", body: "response", contentLength: 100, max: 10, tooLarge: true},
+		{name: "content length not trusted", body: "response", contentLength: 1 << 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Body: io.NopCloser(strings.NewReader(tt.body)), ContentLength: tt.contentLength}
+			body, err := readResponseBody(resp, tt.max)
+			if tt.tooLarge {
+				if !errors.Is(err, errResponseTooLarge) {
+					t.Fatalf("error %v, want errResponseTooLarge", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestFitErrorEnvelope(t *testing.T) {
+	details := NewFunctionErrorDetails(strings.Repeat("m", 4000), "http://fn", http.Header{})
+	details.FunctionHTTPResponse.ResponseBody = strings.Repeat("é", 1000)
+	envelope, err := json.Marshal(details)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := SinkMessage{Topic: "errors", Key: "k", Body: envelope}
+
+	tests := []struct {
+		name      string
+		sink      Sink
+		unchanged bool
+	}{
+		{name: "sink without limit", sink: nopSink{}, unchanged: true},
+		{name: "envelope fits", sink: limitedSink{max: 1 << 20}, unchanged: true},
+		{name: "request cut", sink: limitedSink{max: 3000}},
+		{name: "request and response cut", sink: limitedSink{max: 1000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fitted := fitErrorEnvelope(tt.sink, msg)
+			if tt.unchanged {
+				if string(fitted.Body) != string(envelope) {
+					t.Error("envelope modified")
+				}
+				return
+			}
+			limited := tt.sink.(SizeLimitedSink)
+			if size, max := limited.Size(fitted), limited.MaxMessageSize(); size > max {
+				t.Errorf("envelope of %d bytes exceeds %d bytes", size, max)
+			}
+			var got FunctionErrorDetails
+			if err := json.Unmarshal(fitted.Body, &got); err != nil {
+				t.Fatalf("fitted envelope is not valid: %v", err)
+			}
+			if !got.FunctionHTTPRequest.Truncated {
+				t.Error("request not marked as truncated")
+			}
+		})
+	}
+}
+
+// nopSink is a sink without a maximum message size
+type nopSink struct{}
+
+func (nopSink) Publish(context.Context, SinkMessage) error { return nil }
+func (nopSink) Close() error                               { return nil }
+
+func TestCheckMessageSizes(t *testing.T) {
+	// The headers make up most of the size of the message
+	msg := SinkMessage{Topic: "responses", Key: "k", Body: []byte("response"), Headers: http.Header{"X-Trace": {strings.Repeat("t", 100)}}}
+	tests := []struct {
+		name string
+		sink Sink
+		err  bool
+	}{
+		{name: "sink without limit", sink: nopSink{}},
+		{name: "message fits", sink: limitedSink{max: 200}},
+		{name: "message too large", sink: limitedSink{max: 50}, err: true},
+		{name: "headers not counted", sink: limitedSink{max: 50, headerless: true}},
+		{name: "body too large", sink: limitedSink{max: 5, headerless: true}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkMessageSizes(tt.sink, []SinkMessage{{Topic: "responses"}, msg})
+			if (err != nil) != tt.err {
+				t.Errorf("checking the size returned %v", err)
+			}
+		})
+	}
+}
+
+func TestFitErrorEnvelopeHeaderless(t *testing.T) {
+	details := NewFunctionErrorDetails("message", "http://fn", http.Header{})
+	envelope, err := json.Marshal(details)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := SinkMessage{Topic: "errors", Body: envelope, Headers: http.Header{"X-Trace": {strings.Repeat("t", 1000)}}}
+
+	// Headers the broker drops do not make the envelope too large
+	sink := limitedSink{max: len(envelope), headerless: true}
+	if fitted := fitErrorEnvelope(sink, msg); string(fitted.Body) != string(envelope) {
+		t.Errorf("envelope cut to %d bytes for headers the sink does not count", len(fitted.Body))
+	}
+}
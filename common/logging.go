@@ -0,0 +1,134 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Payload logging modes selected by LOG_PAYLOAD
+const (
+	PayloadLoggingOff       = "off"
+	PayloadLoggingTruncated = "truncated"
+	PayloadLoggingFull      = "full"
+
+	defaultLogPayloadMaxSize = 256
+)
+
+// payloadLogging controls how payloads are logged, it is configured by NewLogger
+var payloadLogging = struct {
+	mode     string
+	maxSize  int
+	redactor *Redactor
+}{mode: PayloadLoggingOff, maxSize: defaultLogPayloadMaxSize}
+
+// NewLogger creates the logger of the connector configured by the LOG_* environment variables:
+//
+//	LOG_LEVEL             debug, info, warn or error, defaults to info
+//	LOG_FORMAT            json or console, defaults to json
+//	LOG_SAMPLING          false disables the sampling of repeated log entries
+//	LOG_PAYLOAD           off, truncated or full, defaults to off
+//	LOG_PAYLOAD_MAX_SIZE  size in bytes payloads are truncated to, defaults to 256
+//	LOG_PAYLOAD_REDACT    regular expression whose matches are redacted from payloads
+//
+// It also configures how PayloadField logs payloads.
+func NewLogger() (*zap.Logger, error) {
+	config := zap.NewProductionConfig()
+
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		level, err := zapcore.ParseLevel(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL: %w", err)
+		}
+		config.Level = zap.NewAtomicLevelAt(level)
+	}
+
+	switch v := os.Getenv("LOG_FORMAT"); v {
+	case "", "json":
+	case "console":
+		config.Encoding = "console"
+		config.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q, must be json or console", v)
+	}
+
+	if v := os.Getenv("LOG_SAMPLING"); v != "" {
+		sampling, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LOG_SAMPLING: %w", err)
+		}
+		if !sampling {
+			config.Sampling = nil
+		}
+	}
+
+	switch v := os.Getenv("LOG_PAYLOAD"); v {
+	case "":
+	case PayloadLoggingOff, PayloadLoggingTruncated, PayloadLoggingFull:
+		payloadLogging.mode = v
+	default:
+		return nil, fmt.Errorf("invalid LOG_PAYLOAD %q, must be off, truncated or full", v)
+	}
+	if v := os.Getenv("LOG_PAYLOAD_MAX_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("LOG_PAYLOAD_MAX_SIZE must be a number of bytes, got %q", v)
+		}
+		payloadLogging.maxSize = size
+	}
+	redactor, err := NewRedactor("", os.Getenv("LOG_PAYLOAD_REDACT"))
+	if err != nil {
+		return nil, err
+	}
+	payloadLogging.redactor = redactor
+
+	return config.Build()
+}
+
+// PayloadField logs a message payload or function response according to LOG_PAYLOAD. It
+// must be used instead of zap.String for any data received from the broker or the function.
+func PayloadField(key string, payload []byte) zap.Field {
+	if payloadLogging.mode != PayloadLoggingTruncated && payloadLogging.mode != PayloadLoggingFull {
+		return zap.Skip()
+	}
+
+	value := string(payload)
+	if payloadLogging.redactor != nil {
+		value = payloadLogging.redactor.Body(value)
+	}
+	if payloadLogging.mode == PayloadLoggingTruncated {
+		value, _ = truncate(value, payloadLogging.maxSize)
+	}
+	return zap.String(key, value)
+}
+
+// InvocationErrorFields logs an error returned by HandleHTTPRequest. The request and
+// response of failed invocations are only logged according to LOG_PAYLOAD.
+func InvocationErrorFields(err error) []zap.Field {
+	details, ok := parseFunctionErrorDetails(err)
+	if !ok {
+		return []zap.Field{zap.String("function_error", err.Error())}
+	}
+	return []zap.Field{
+		zap.String("function_error", details.FunctionHTTPResponse.ErrorString),
+		zap.Int("status_code", details.FunctionHTTPResponse.StatusCode),
+		PayloadField("message", []byte(details.FunctionHTTPRequest.Message)),
+		PayloadField("response", []byte(details.FunctionHTTPResponse.ResponseBody)),
+	}
+}
+
+// parseFunctionErrorDetails returns the details of a failed invocation carried by the
+// errors of HandleHTTPRequest
+func parseFunctionErrorDetails(err error) (FunctionErrorDetails, bool) {
+	var details FunctionErrorDetails
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "{") || json.Unmarshal([]byte(msg), &details) != nil {
+		return details, false
+	}
+	return details, true
+}
@@ -0,0 +1,126 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// setLogEnv sets the LOG_* variables of a test, the others are cleared. The payload
+// logging configured by NewLogger is restored at the end of the test.
+func setLogEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for _, key := range []string{"LOG_LEVEL", "LOG_FORMAT", "LOG_SAMPLING", "LOG_PAYLOAD", "LOG_PAYLOAD_MAX_SIZE", "LOG_PAYLOAD_REDACT"} {
+		t.Setenv(key, env[key])
+	}
+	previous := payloadLogging
+	t.Cleanup(func() { payloadLogging = previous })
+}
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		debug bool
+		err   bool
+	}{
+		{name: "defaults"},
+		{name: "debug console", env: map[string]string{"LOG_LEVEL": "debug", "LOG_FORMAT": "console", "LOG_SAMPLING": "false"}, debug: true},
+		{name: "invalid level", env: map[string]string{"LOG_LEVEL": "verbose"}, err: true},
+		{name: "invalid format", env: map[string]string{"LOG_FORMAT": "xml"}, err: true},
+		{name: "invalid sampling", env: map[string]string{"LOG_SAMPLING": "sometimes"}, err: true},
+		{name: "invalid payload mode", env: map[string]string{"LOG_PAYLOAD": "partial"}, err: true},
+		{name: "negative payload size", env: map[string]string{"LOG_PAYLOAD": "truncated", "LOG_PAYLOAD_MAX_SIZE": "-1"}, err: true},
+		{name: "invalid redaction", env: map[string]string{"LOG_PAYLOAD_REDACT": "["}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setLogEnv(t, tt.env)
+			logger, err := NewLogger()
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if debug := logger.Core().Enabled(zapcore.DebugLevel); debug != tt.debug {
+				t.Errorf("debug enabled %v, want %v", debug, tt.debug)
+			}
+		})
+	}
+}
+
+func TestPayloadField(t *testing.T) {
+	payload := []byte(`{"card":"4111111111111111","amount":10}`)
+	tests := []struct {
+		name string
+		env  map[string]string
+		// want is the logged payload, the field is skipped when it is empty
+		want string
+	}{
+		{name: "off by default"},
+		{name: "off", env: map[string]string{"LOG_PAYLOAD": "off"}},
+		{name: "full", env: map[string]string{"LOG_PAYLOAD": "full", "LOG_PAYLOAD_MAX_SIZE": "4"}, want: string(payload)},
+		{name: "truncated", env: map[string]string{"LOG_PAYLOAD": "truncated", "LOG_PAYLOAD_MAX_SIZE": "8"}, want: `{"card":`},
+		{
+			name: "redacted",
+			env:  map[string]string{"LOG_PAYLOAD": "full", "LOG_PAYLOAD_REDACT": `[0-9]{16}`},
+			want: `{"card":"[REDACTED]","amount":10}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setLogEnv(t, tt.env)
+			if _, err := NewLogger(); err != nil {
+				t.Fatal(err)
+			}
+			field := PayloadField("message", payload)
+			if tt.want == "" {
+				if field.Type != zapcore.SkipType {
+					t.Errorf("payload logged as %q", field.String)
+				}
+				return
+			}
+			if field.Key != "message" || field.String != tt.want {
+				t.Errorf("payload logged as %s=%q, want %q", field.Key, field.String, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvocationErrorFields(t *testing.T) {
+	setLogEnv(t, map[string]string{"LOG_PAYLOAD": "full"})
+	if _, err := NewLogger(); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := InvocationErrorFields(errors.New("connection refused"))
+	if len(fields) != 1 || fields[0].String != "connection refused" {
+		t.Errorf("fields %v of a plain error", fields)
+	}
+
+	details, _ := json.Marshal(FunctionErrorDetails{
+		FunctionHTTPRequest:  FunctionHTTPRequest{Message: "order"},
+		FunctionHTTPResponse: FunctionHTTPResponse{StatusCode: http.StatusConflict, ResponseBody: "duplicate", ErrorString: "conflict"},
+	})
+	values := map[string]any{}
+	for _, field := range InvocationErrorFields(errors.New(string(details))) {
+		if field.Type == zapcore.Int64Type {
+			values[field.Key] = int(field.Integer)
+			continue
+		}
+		values[field.Key] = field.String
+	}
+	want := map[string]any{"function_error": "conflict", "status_code": http.StatusConflict, "message": "order", "response": "duplicate"}
+	for key, value := range want {
+		if values[key] != value {
+			t.Errorf("field %s is %v, want %v", key, values[key], value)
+		}
+	}
+}
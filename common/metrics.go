@@ -0,0 +1,46 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"time"
+)
+
+// Metric names published under the "keda_connector" expvar map
+const (
+	MetricFunctionInvocations        = "function_invocations"
+	MetricFunctionInvocationFailures = "function_invocation_failures"
+	MetricFunctionInvocationRetries  = "function_invocation_retries"
+)
+
+var metrics = expvar.NewMap("keda_connector")
+
+// IncMetric increments the named connector counter by one
+func IncMetric(name string) {
+	metrics.Add(name, 1)
+}
+
+// ServeMetrics serves the expvar metrics on /metrics until ctx is cancelled
+func ServeMetrics(ctx context.Context, address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", expvar.Handler())
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
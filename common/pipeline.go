@@ -0,0 +1,358 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Pipeline invokes the function for every message received from a Source and routes
+// the function response and errors to the response and error sinks
+type Pipeline struct {
+	connectordata ConnectorMetadata
+	logger        *zap.Logger
+	responseSink  Sink
+	errorSink     Sink
+	// owned holds the sinks created by the pipeline which have to be closed with it
+	owned []Sink
+	// tap records sampled invocations, nil when disabled
+	tap *Tap
+
+	// AckAfterError acknowledges messages for which the function failed once the failure
+	// has been handled, instead of leaving them to the redelivery of the broker
+	AckAfterError bool
+	// AckOnlyIfErrorPublished leaves messages whose error could not be published to the
+	// redelivery of the broker instead of acknowledging them after an error
+	AckOnlyIfErrorPublished bool
+	// SkipErrorPublish only logs failures, for sources processing a failed message again until
+	// it succeeds, which would otherwise publish its error on every attempt
+	SkipErrorPublish bool
+	// ErrorPublishRetries is the number of times publishing to the error topic is retried,
+	// messages whose error could not be published are negatively acknowledged
+	ErrorPublishRetries int
+}
+
+// NewPipeline creates a pipeline publishing to the sinks configured by RESPONSE_SINK and
+// ERROR_SINK. When a sink is not configured, defaultSink, the broker the connector consumes
+// from, is used instead. defaultSink is not closed by the pipeline.
+func NewPipeline(ctx context.Context, logger *zap.Logger, connectordata ConnectorMetadata, defaultSink Sink) (*Pipeline, error) {
+	p := &Pipeline{
+		connectordata: connectordata,
+		logger:        logger,
+		responseSink:  defaultSink,
+		errorSink:     defaultSink,
+	}
+
+	tap, err := NewTapFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tap: %w", err)
+	}
+	p.tap = tap
+
+	if connectordata.ResponseSink != "" {
+		sink, err := NewSink(ctx, connectordata.ResponseSink, connectordata, logger)
+		if err != nil {
+			_ = p.Close()
+			return nil, fmt.Errorf("failed to create response sink: %w", err)
+		}
+		p.responseSink = sink
+		p.owned = append(p.owned, sink)
+	}
+
+	if connectordata.ErrorSink != "" {
+		if connectordata.ErrorSink == connectordata.ResponseSink {
+			p.errorSink = p.responseSink
+		} else {
+			sink, err := NewSink(ctx, connectordata.ErrorSink, connectordata, logger)
+			if err != nil {
+				_ = p.Close()
+				return nil, fmt.Errorf("failed to create error sink: %w", err)
+			}
+			p.errorSink = sink
+			p.owned = append(p.owned, sink)
+		}
+	}
+	return p, nil
+}
+
+// Close waits for the deliveries to secondary endpoints still running in the background, at
+// most SecondaryTimeout, and closes the sinks, the tap and the gRPC connections of the pipeline
+func (p *Pipeline) Close() error {
+	if p.connectordata.DeliveryPolicy == DeliveryPolicyPrimary {
+		ctx, cancel := context.WithTimeout(context.Background(), p.connectordata.SecondaryTimeout)
+		defer cancel()
+		if err := state.waitIdle(ctx); err != nil {
+			p.logger.Warn("deliveries to secondary endpoints still in flight at shutdown")
+		}
+	}
+	firstErr := p.tap.Close()
+	for _, sink := range p.owned {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := closeGRPCConns(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// Handle invokes the function with msg, publishes the response or error and acknowledges
+// msg once its outcome has been published
+func (p *Pipeline) Handle(ctx context.Context, msg Message) {
+	state.messageStarted()
+	defer state.messageDone()
+
+	// The route selects the endpoint and the topics of the message
+	route, data := p.connectordata.Routes.Route(msg.Body(), msg.Headers(), p.connectordata)
+	data.message = msg
+
+	sampled := p.tap.Sampled()
+	start := time.Now()
+	// The invocation is not interrupted by the shutdown of the source, the outcome of the
+	// messages in flight is still published
+	resp, err := InvokeFunction(context.WithoutCancel(ctx), msg.Body(), msg.Headers(), data, p.logger)
+	if err != nil {
+		if sampled {
+			p.record(msg, nil, nil, err, time.Since(start))
+		}
+		p.handleError(ctx, data, msg, err)
+		return
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			p.logger.Error("failed to close response body", zap.Error(err))
+		}
+	}()
+
+	// The function can choose where its response goes with the reserved response headers.
+	// The destination is known before the body is read, so that it is only read when needed.
+	dest, destErr := data.responseDestination(msg.Key(), resp.Header)
+	replyable, isReplyable := p.replyable(msg)
+	if destErr == nil && !sampled && !isReplyable && dest.split == "" && (dest.drop || len(dest.topic) == 0) &&
+		!p.logger.Core().Enabled(zap.DebugLevel) {
+		if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+			p.handleError(ctx, data, msg, err)
+			return
+		}
+		p.ack(msg)
+		return
+	}
+
+	// A response published as one message is not read further than the response sink accepts
+	limit := data.MaxResponseSize
+	reason := fmt.Sprintf("response exceeds MAX_RESPONSE_SIZE of %d bytes", data.MaxResponseSize)
+	if limited, ok := p.responseSink.(SizeLimitedSink); ok && destErr == nil && !isReplyable &&
+		!dest.drop && len(dest.topic) > 0 && dest.split == "" {
+		if sinkMax := int64(limited.MaxMessageSize()); limit == 0 || sinkMax < limit {
+			limit = sinkMax
+			reason = fmt.Sprintf("response exceeds the maximum message size of %d bytes of the response sink", sinkMax)
+		}
+	}
+	body, err := readResponseBody(resp, limit)
+	if errors.Is(err, errResponseTooLarge) {
+		err = responseSizeError(string(msg.Body()), msg.Headers(), resp, data, reason)
+	}
+	if sampled {
+		p.record(msg, resp, body, err, time.Since(start))
+	}
+	if err != nil {
+		p.handleError(ctx, data, msg, err)
+		return
+	}
+
+	p.logger.Debug("function invoked",
+		zap.Int("status_code", resp.StatusCode),
+		zap.String("source", p.connectordata.SourceName),
+		zap.String("route", route),
+		PayloadField("message", msg.Body()),
+		PayloadField("response", body))
+
+	var msgs []SinkMessage
+	err = destErr
+	if err == nil {
+		msgs, err = dest.messages(body, resp.Header)
+	}
+	if err != nil {
+		p.handleError(ctx, data, msg, err)
+		return
+	}
+
+	// In RPC mode the response goes to the reply address of the message instead
+	var published bool
+	if isReplyable {
+		published = dest.drop || p.reply(ctx, replyable, body, resp.Header)
+	} else {
+		// Responses the broker would reject are published to the error topic instead
+		if err := checkMessageSizes(p.responseSink, msgs); err != nil && !dest.drop && len(dest.topic) > 0 {
+			p.handleError(ctx, data, msg, responseSizeError(string(msg.Body()), msg.Headers(), resp, data, err.Error()))
+			return
+		}
+		published = p.publishResponse(ctx, data, dest, msgs)
+	}
+	if !published {
+		p.nack(msg)
+		return
+	}
+	p.ack(msg)
+}
+
+func (p *Pipeline) publishResponse(ctx context.Context, data ConnectorMetadata, dest responseDestination, msgs []SinkMessage) bool {
+	if dest.drop || len(dest.topic) == 0 {
+		return true
+	}
+
+	var err error
+	if batch, ok := p.responseSink.(BatchSink); ok && len(msgs) > 1 {
+		err = batch.PublishBatch(ctx, msgs)
+	} else {
+		for _, msg := range msgs {
+			if err = p.responseSink.Publish(ctx, msg); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		p.logger.Error("failed to publish response body from http request to topic",
+			zap.Error(err),
+			zap.String("topic", dest.topic),
+			zap.String("source", data.SourceName),
+			zap.String("http endpoint", data.HTTPEndpoint))
+		return false
+	}
+	return true
+}
+
+func (p *Pipeline) handleError(ctx context.Context, data ConnectorMetadata, msg Message, err error) {
+	if deferrable, ok := msg.(DeferrableMessage); ok {
+		deferred, deferErr := deferrable.Defer(ctx, err)
+		if deferErr != nil {
+			p.logger.Error("failed to defer message",
+				append(InvocationErrorFields(err),
+					zap.NamedError("defer_error", deferErr),
+					zap.String("source", data.SourceName))...)
+			p.nack(msg)
+			return
+		}
+		if deferred {
+			p.logger.Debug("message deferred after function failure", zap.String("source", data.SourceName))
+			p.ack(msg)
+			return
+		}
+	}
+
+	// A failure is only handled once it has been published to the error topic
+	handled := true
+	defer func() {
+		if p.AckAfterError && (handled || !p.AckOnlyIfErrorPublished) {
+			p.ack(msg)
+		} else {
+			p.nack(msg)
+		}
+	}()
+
+	// The caller waiting for the reply gets the error envelope right away
+	if replyable, ok := p.replyable(msg); ok {
+		p.reply(ctx, replyable, []byte(err.Error()), http.Header{HeaderFunctionError: {"true"}})
+	}
+
+	if p.SkipErrorPublish {
+		p.logger.Error("function invocation failed",
+			append(InvocationErrorFields(err),
+				zap.String("source", data.SourceName),
+				zap.String("http endpoint", data.HTTPEndpoint))...)
+		return
+	}
+
+	if len(data.ErrorTopic) == 0 {
+		p.logger.Error("message received to publish to error topic, but no error topic was set",
+			append(InvocationErrorFields(err),
+				zap.String("source", data.SourceName),
+				zap.String("http endpoint", data.HTTPEndpoint))...)
+		return
+	}
+
+	// An envelope the error sink would reject could never be published
+	publishErr := p.publishError(ctx, fitErrorEnvelope(p.errorSink, SinkMessage{
+		Topic:   data.ErrorTopic,
+		Key:     msg.Key(),
+		Body:    []byte(err.Error()),
+		Durable: true,
+	}))
+	if publishErr != nil {
+		handled = false
+		p.logger.Error("failed to publish message to error topic",
+			append(InvocationErrorFields(err),
+				zap.Error(publishErr),
+				zap.String("source", data.SourceName),
+				zap.String("topic", data.ErrorTopic))...)
+	}
+}
+
+// publishError publishes msg to the error sink, retrying up to ErrorPublishRetries times
+// with an exponential backoff
+func (p *Pipeline) publishError(ctx context.Context, msg SinkMessage) error {
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := p.errorSink.Publish(ctx, msg)
+		if err == nil || attempt >= p.ErrorPublishRetries {
+			return err
+		}
+		p.logger.Warn("failed to publish message to error topic, retrying",
+			zap.Error(err),
+			zap.String("topic", msg.Topic),
+			zap.Int("attempt", attempt+1))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// replyable returns msg if the response has to be published to its reply address
+func (p *Pipeline) replyable(msg Message) (ReplyableMessage, bool) {
+	if !p.connectordata.RPCMode {
+		return nil, false
+	}
+	replyable, ok := msg.(ReplyableMessage)
+	if !ok || replyable.ReplyTo() == "" {
+		return nil, false
+	}
+	return replyable, true
+}
+
+func (p *Pipeline) reply(ctx context.Context, msg ReplyableMessage, body []byte, headers http.Header) bool {
+	if err := msg.Reply(ctx, body, headers); err != nil {
+		p.logger.Error("failed to publish reply",
+			zap.Error(err),
+			zap.String("reply_to", msg.ReplyTo()),
+			zap.String("source", p.connectordata.SourceName))
+		return false
+	}
+	return true
+}
+
+func (p *Pipeline) record(msg Message, resp *http.Response, body []byte, err error, latency time.Duration) {
+	if tapErr := p.tap.Record(p.connectordata.SourceName, msg, resp, body, err, latency); tapErr != nil {
+		p.logger.Error("failed to write tap record", zap.Error(tapErr))
+	}
+}
+
+func (p *Pipeline) ack(msg Message) {
+	if err := msg.Ack(); err != nil {
+		p.logger.Error("failed to acknowledge message", zap.Error(err), zap.String("source", p.connectordata.SourceName))
+	}
+}
+
+func (p *Pipeline) nack(msg Message) {
+	if err := msg.Nack(); err != nil {
+		p.logger.Error("failed to negatively acknowledge message", zap.Error(err), zap.String("source", p.connectordata.SourceName))
+	}
+}
@@ -0,0 +1,312 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// testMessage is a message of a broker with partitions, it counts its acknowledgements
+type testMessage struct {
+	body     []byte
+	headers  http.Header
+	key      string
+	position map[string]string
+
+	mu    sync.Mutex
+	acks  int
+	nacks int
+}
+
+func (m *testMessage) Body() []byte                { return m.body }
+func (m *testMessage) Headers() http.Header        { return m.headers }
+func (m *testMessage) Key() string                 { return m.key }
+func (m *testMessage) Position() map[string]string { return m.position }
+
+func (m *testMessage) Ack() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.acks++
+	return nil
+}
+
+func (m *testMessage) Nack() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nacks++
+	return nil
+}
+
+// outcome returns the number of acknowledgements and negative acknowledgements of m
+func (m *testMessage) outcome() (int, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.acks, m.nacks
+}
+
+var errTestPublish = errors.New("broker unavailable")
+
+// recordingSink records the messages published to it
+type recordingSink struct {
+	mu   sync.Mutex
+	msgs []SinkMessage
+	// failures is the number of publications failing before messages are accepted, they
+	// always fail when it is negative
+	failures int
+	closed   bool
+}
+
+func (s *recordingSink) Publish(_ context.Context, msg SinkMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures != 0 {
+		if s.failures > 0 {
+			s.failures--
+		}
+		return errTestPublish
+	}
+	s.msgs = append(s.msgs, msg)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *recordingSink) published() []SinkMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SinkMessage(nil), s.msgs...)
+}
+
+// testSinks holds the sinks created for test:// URLs by host
+var testSinks sync.Map
+
+func init() {
+	RegisterSink("test", func(_ context.Context, u *url.URL, _ ConnectorMetadata, _ *zap.Logger) (Sink, error) {
+		sink := &recordingSink{}
+		testSinks.Store(u.Host, sink)
+		return sink, nil
+	})
+}
+
+// functionServer starts a function answering every invocation with status and body
+func functionServer(t *testing.T, status int, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestPipeline(t *testing.T, data ConnectorMetadata, sink Sink) *Pipeline {
+	t.Helper()
+	t.Setenv("TAP_OUTPUT", "")
+	p, err := NewPipeline(context.Background(), zap.NewNop(), data, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = p.Close() })
+	return p
+}
+
+func TestPipelineHandle(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		responseTopic string
+		ackAfterError bool
+		sinkFailures  int
+		// topic is the topic a message is published to, empty if none is
+		topic string
+		acks  int
+		nacks int
+	}{
+		{name: "response published", status: http.StatusOK, responseTopic: "responses", topic: "responses", acks: 1},
+		{name: "no response topic", status: http.StatusOK, acks: 1},
+		{name: "response not published", status: http.StatusOK, responseTopic: "responses", sinkFailures: -1, nacks: 1},
+		{name: "error left to redelivery", status: http.StatusInternalServerError, responseTopic: "responses", topic: "errors", nacks: 1},
+		{name: "error acknowledged", status: http.StatusInternalServerError, responseTopic: "responses", ackAfterError: true, topic: "errors", acks: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := functionServer(t, tt.status, "response")
+			sink := &recordingSink{failures: tt.sinkFailures}
+			p := newTestPipeline(t, ConnectorMetadata{
+				HTTPEndpoint:  srv.URL,
+				ResponseTopic: tt.responseTopic,
+				ErrorTopic:    "errors",
+				SourceName:    "test",
+			}, sink)
+			p.AckAfterError = tt.ackAfterError
+
+			msg := &testMessage{body: []byte("message"), key: "key"}
+			p.Handle(context.Background(), msg)
+
+			if acks, nacks := msg.outcome(); acks != tt.acks || nacks != tt.nacks {
+				t.Errorf("%d acks and %d nacks, want %d and %d", acks, nacks, tt.acks, tt.nacks)
+			}
+			published := sink.published()
+			if tt.topic == "" {
+				if len(published) > 0 {
+					t.Errorf("published %d messages, want none", len(published))
+				}
+				return
+			}
+			if len(published) != 1 {
+				t.Fatalf("published %d messages, want 1", len(published))
+			}
+			if published[0].Topic != tt.topic || published[0].Key != "key" {
+				t.Errorf("published to %s with key %q, want %s with key %q", published[0].Topic, published[0].Key, tt.topic, "key")
+			}
+			// The message is only acknowledged once its error has been published
+			if durable := tt.topic == "errors"; published[0].Durable != durable {
+				t.Errorf("published durable %v, want %v", published[0].Durable, durable)
+			}
+			if tt.topic == "errors" {
+				var details FunctionErrorDetails
+				if err := json.Unmarshal(published[0].Body, &details); err != nil {
+					t.Fatalf("error is not an envelope: %v", err)
+				}
+				if details.FunctionHTTPRequest.Message != "message" || details.FunctionHTTPResponse.StatusCode != tt.status {
+					t.Errorf("envelope of %q with status %d", details.FunctionHTTPRequest.Message, details.FunctionHTTPResponse.StatusCode)
+				}
+			} else if string(published[0].Body) != "response" {
+				t.Errorf("published %q, want the response", published[0].Body)
+			}
+		})
+	}
+}
+
+func TestPipelineSendsMessage(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(nil)
+		r.Header.Set("X-Body", string(body))
+		received <- r
+	}))
+	defer srv.Close()
+
+	p := newTestPipeline(t, ConnectorMetadata{HTTPEndpoint: srv.URL}, &recordingSink{})
+	p.Handle(context.Background(), &testMessage{body: []byte(`{"id": 1}`), headers: http.Header{"X-Tenant": {"acme"}}})
+
+	r := <-received
+	if r.Method != http.MethodPost || r.Header.Get("X-Body") != `{"id": 1}` || r.Header.Get("X-Tenant") != "acme" {
+		t.Errorf("function received %s with body %q and tenant %q", r.Method, r.Header.Get("X-Body"), r.Header.Get("X-Tenant"))
+	}
+}
+
+func TestPipelineErrorPublishRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		retries   int
+		published bool
+	}{
+		{name: "published first time", retries: 2, published: true},
+		{name: "published after retries", failures: 2, retries: 2, published: true},
+		{name: "retries exhausted", failures: 3, retries: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := functionServer(t, http.StatusBadRequest, "invalid")
+			sink := &recordingSink{failures: tt.failures}
+			p := newTestPipeline(t, ConnectorMetadata{HTTPEndpoint: srv.URL, ErrorTopic: "errors"}, sink)
+			p.ErrorPublishRetries = tt.retries
+
+			p.Handle(context.Background(), &testMessage{body: []byte("message")})
+			if published := len(sink.published()) == 1; published != tt.published {
+				t.Errorf("error published %v, want %v", published, tt.published)
+			}
+		})
+	}
+}
+
+func TestPipelineSinks(t *testing.T) {
+	srv := functionServer(t, http.StatusOK, "response")
+	defaultSink := &recordingSink{}
+	p := newTestPipeline(t, ConnectorMetadata{
+		HTTPEndpoint:  srv.URL,
+		ResponseTopic: "responses",
+		ResponseSink:  "test://pipeline-responses",
+		ErrorSink:     "test://pipeline-responses",
+	}, defaultSink)
+
+	p.Handle(context.Background(), &testMessage{body: []byte("message")})
+
+	value, ok := testSinks.Load("pipeline-responses")
+	if !ok {
+		t.Fatal("response sink not created")
+	}
+	sink := value.(*recordingSink)
+	if len(sink.published()) != 1 || len(defaultSink.published()) != 0 {
+		t.Errorf("%d responses published to RESPONSE_SINK and %d to the source", len(sink.published()), len(defaultSink.published()))
+	}
+	if p.errorSink != p.responseSink {
+		t.Error("the same sink URL created two sinks")
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !sink.closed || defaultSink.closed {
+		t.Errorf("sink created by the pipeline closed %v, sink of the source closed %v", sink.closed, defaultSink.closed)
+	}
+}
+
+func TestNewSinkUnknownScheme(t *testing.T) {
+	if _, err := NewSink(context.Background(), "carrier-pigeon://loft", ConnectorMetadata{}, zap.NewNop()); err == nil {
+		t.Error("sink created for an unknown scheme")
+	}
+}
+
+func TestPipelineErrorHandling(t *testing.T) {
+	tests := []struct {
+		name                    string
+		ackOnlyIfErrorPublished bool
+		skipErrorPublish        bool
+		sinkFailures            int
+		published               bool
+		acks                    int
+		nacks                   int
+	}{
+		{name: "error published", ackOnlyIfErrorPublished: true, published: true, acks: 1},
+		{name: "error not published", ackOnlyIfErrorPublished: true, sinkFailures: -1, nacks: 1},
+		{name: "acknowledged although not published", sinkFailures: -1, acks: 1},
+		{name: "error only logged", ackOnlyIfErrorPublished: true, skipErrorPublish: true, acks: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := functionServer(t, http.StatusInternalServerError, "failed")
+			sink := &recordingSink{failures: tt.sinkFailures}
+			p := newTestPipeline(t, ConnectorMetadata{HTTPEndpoint: srv.URL, ErrorTopic: "errors"}, sink)
+			p.AckAfterError = true
+			p.AckOnlyIfErrorPublished = tt.ackOnlyIfErrorPublished
+			p.SkipErrorPublish = tt.skipErrorPublish
+
+			msg := &testMessage{body: []byte("message")}
+			p.Handle(context.Background(), msg)
+			if acks, nacks := msg.outcome(); acks != tt.acks || nacks != tt.nacks {
+				t.Errorf("%d acks and %d nacks, want %d and %d", acks, nacks, tt.acks, tt.nacks)
+			}
+			if published := len(sink.published()) == 1; published != tt.published {
+				t.Errorf("error published %v, want %v", published, tt.published)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// redacted replaces header values and body matches removed by a Redactor
+const redacted = "[REDACTED]"
+
+// defaultRedactedHeaders are the headers redacted when no header is configured
+var defaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Redactor removes sensitive values from headers and payloads before they are written
+// outside of the function invocation, e.g. to a tap file or the logs
+type Redactor struct {
+	headers map[string]bool
+	body    *regexp.Regexp
+}
+
+// NewRedactor creates a Redactor redacting the values of the comma separated headers and
+// the matches of the bodyPattern regular expression. The default headers are redacted
+// when headers is empty, and bodies are left untouched when bodyPattern is empty.
+func NewRedactor(headers, bodyPattern string) (*Redactor, error) {
+	r := &Redactor{headers: map[string]bool{}}
+
+	names := defaultRedactedHeaders
+	if headers != "" {
+		names = strings.Split(headers, ",")
+	}
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			r.headers[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+
+	if bodyPattern != "" {
+		body, err := regexp.Compile(bodyPattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile body redaction pattern: %w", err)
+		}
+		r.body = body
+	}
+	return r, nil
+}
+
+// Headers returns a copy of headers with the values of the redacted headers replaced
+func (r *Redactor) Headers(headers http.Header) http.Header {
+	if headers == nil {
+		return nil
+	}
+	out := make(http.Header, len(headers))
+	for key, values := range headers {
+		if r.headers[http.CanonicalHeaderKey(key)] {
+			out[key] = []string{redacted}
+			continue
+		}
+		out[key] = values
+	}
+	return out
+}
+
+// Body returns body with the matches of the body pattern replaced
+func (r *Redactor) Body(body string) string {
+	if r.body == nil {
+		return body
+	}
+	return r.body.ReplaceAllString(body, redacted)
+}
+
+// truncate cuts s to at most max bytes without splitting a multi-byte character
+func truncate(s string, max int) (string, bool) {
+	if len(s) <= max {
+		return s, false
+	}
+	cut := max
+	for cut > 0 && cut > max-utf8.UTFMax && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut], true
+}
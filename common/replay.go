@@ -0,0 +1,245 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type (
+	// replayRecord is a line of a replay file. It is either a payload with optional headers,
+	//
+	//	{"payload": {"id": 1}, "headers": {"X-Request-Id": "abc"}}
+	//
+	// or the error envelope published to the error topic by HandleHTTPRequest, in which
+	// case the request recorded in the envelope is sent again.
+	replayRecord struct {
+		Payload             json.RawMessage      `json:"payload"`
+		Headers             jsonHeaders          `json:"headers"`
+		FunctionHTTPRequest *FunctionHTTPRequest `json:"FunctionHTTPRequest"`
+	}
+
+	// jsonHeaders are headers in JSON which accept values both as a string and as a list of strings
+	jsonHeaders http.Header
+)
+
+func (h *jsonHeaders) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	headers := make(jsonHeaders, len(raw))
+	for key, value := range raw {
+		var single string
+		if err := json.Unmarshal(value, &single); err == nil {
+			headers[key] = []string{single}
+			continue
+		}
+		var multi []string
+		if err := json.Unmarshal(value, &multi); err != nil {
+			return fmt.Errorf("header %q must be a string or a list of strings", key)
+		}
+		headers[key] = multi
+	}
+	*h = headers
+	return nil
+}
+
+// message returns the payload and the headers recorded for the message
+func (r replayRecord) message() (string, http.Header, error) {
+	if r.FunctionHTTPRequest != nil {
+		if r.FunctionHTTPRequest.Truncated {
+			return "", nil, errors.New("the message of the error envelope was truncated to fit the error sink")
+		}
+		return r.FunctionHTTPRequest.Message, r.FunctionHTTPRequest.Headers, nil
+	}
+	if r.Payload == nil {
+		return "", nil, errors.New("record has neither payload nor FunctionHTTPRequest")
+	}
+
+	// String payloads are sent as is, any other JSON value is sent as JSON
+	var payload string
+	if err := json.Unmarshal(r.Payload, &payload); err != nil {
+		payload = string(r.Payload)
+	}
+	return payload, http.Header(r.Headers), nil
+}
+
+// jsonHeadersFor returns the headers cmd sends with every message overwritten by the
+// headers recorded for the message
+func jsonHeadersFor(cmd Command, connectordata ConnectorMetadata, recorded http.Header) http.Header {
+	headers := http.Header{}
+	if cmd.Headers != nil {
+		headers = cmd.Headers(connectordata)
+	}
+	for key, values := range recorded {
+		// Connector headers are not always canonical, e.g. RespTopic for NATS
+		for existing := range headers {
+			if strings.EqualFold(existing, key) {
+				delete(headers, existing)
+			}
+		}
+		headers[key] = values
+	}
+	return headers
+}
+
+// runReplay sends the records of JSONL files to the function like the selected connector
+// would and reports the outcome of every record
+func runReplay(name string, args []string, cmds map[string]Command) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	connectorName := fs.String("connector", "", "connector whose headers are sent with every record")
+	printResponse := fs.Bool("print-response", false, "print the body returned by the function")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s -connector <connector> [flags] [file.jsonl ...]\n\nRecords are read from stdin when no file is given.\n\n", name)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	cmd, ok := cmds[*connectorName]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown connector %q\n\n", *connectorName)
+		fs.Usage()
+		return 2
+	}
+
+	logger, err := NewLogger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't initialize zap logger: %v\n", err)
+		return 1
+	}
+	defer func() {
+		_ = logger.Sync()
+	}()
+	logger = logger.With(zap.String("connector", cmd.Name), zap.Bool("replay", true))
+
+	// Only the endpoint is needed to send records, the other settings are optional
+	connectordata, err := parseConnectorMetadata("HTTP_ENDPOINT")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse connector metadata: %v\n", err)
+		return 1
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	defer func() {
+		if err := closeGRPCConns(); err != nil {
+			logger.Warn("failed to close grpc connections", zap.Error(err))
+		}
+	}()
+	r := replayer{
+		cmd:           cmd,
+		connectordata: connectordata,
+		logger:        logger,
+		out:           os.Stdout,
+		printResponse: *printResponse,
+	}
+	for _, file := range files {
+		if err := r.replayFile(file); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to replay %s: %v\n", file, err)
+			return 1
+		}
+	}
+
+	fmt.Fprintf(r.out, "replayed %d records: %d succeeded, %d failed\n", r.succeeded+r.failed, r.succeeded, r.failed)
+	if r.failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+type replayer struct {
+	cmd           Command
+	connectordata ConnectorMetadata
+	logger        *zap.Logger
+	out           io.Writer
+	printResponse bool
+
+	succeeded int
+	failed    int
+}
+
+func (r *replayer) replayFile(file string) error {
+	var in io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	scanner := bufio.NewScanner(in)
+	// Allow records up to 16MB, the default limit of 64KB is too small for most payloads
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		r.replayRecord(fmt.Sprintf("%s:%d", file, line), data)
+	}
+	return scanner.Err()
+}
+
+func (r *replayer) replayRecord(position string, data []byte) {
+	var record replayRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		r.failed++
+		fmt.Fprintf(r.out, "%s: invalid record: %v\n", position, err)
+		return
+	}
+	payload, recorded, err := record.message()
+	if err != nil {
+		r.failed++
+		fmt.Fprintf(r.out, "%s: invalid record: %v\n", position, err)
+		return
+	}
+
+	headers := jsonHeadersFor(r.cmd, r.connectordata, recorded)
+	route, connectordata := r.connectordata.Routes.Route([]byte(payload), headers, r.connectordata)
+	if route != "" {
+		fmt.Fprintf(r.out, "%s: route %s\n", position, route)
+	}
+
+	start := time.Now()
+	resp, err := HandleHTTPRequest(payload, headers, connectordata, r.logger)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		r.failed++
+		fmt.Fprintf(r.out, "%s: failed after %v: %v\n", position, elapsed, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	r.succeeded++
+	fmt.Fprintf(r.out, "%s: %s in %v\n", position, resp.Status, elapsed)
+	if r.printResponse {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			fmt.Fprintf(r.out, "%s: failed to read response body: %v\n", position, err)
+			return
+		}
+		fmt.Fprintf(r.out, "%s\n", body)
+	}
+}
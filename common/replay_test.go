@@ -0,0 +1,171 @@
+package common
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestReplayRecordMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  string
+		payload string
+		headers http.Header
+		err     bool
+	}{
+		{name: "JSON payload", record: `{"payload": {"id": 1}}`, payload: `{"id": 1}`},
+		{name: "string payload", record: `{"payload": "plain text"}`, payload: "plain text"},
+		{
+			name:    "headers",
+			record:  `{"payload": 1, "headers": {"X-Request-Id": "abc", "X-Tags": ["a", "b"]}}`,
+			payload: "1",
+			headers: http.Header{"X-Request-Id": {"abc"}, "X-Tags": {"a", "b"}},
+		},
+		{
+			name:    "error envelope",
+			record:  `{"FunctionHTTPRequest": {"Message": "order", "Headers": {"Topic": ["orders"]}}, "FunctionHTTPResponse": {"StatusCode": 500}}`,
+			payload: "order",
+			headers: http.Header{"Topic": {"orders"}},
+		},
+		{name: "truncated error envelope", record: `{"FunctionHTTPRequest": {"Message": "ord", "Truncated": true}}`, err: true},
+		{name: "no payload", record: `{"headers": {"X-Request-Id": "abc"}}`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var record replayRecord
+			if err := json.Unmarshal([]byte(tt.record), &record); err != nil {
+				t.Fatal(err)
+			}
+			payload, headers, err := record.message()
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if payload != tt.payload {
+				t.Errorf("payload %q, want %q", payload, tt.payload)
+			}
+			if len(headers) != len(tt.headers) {
+				t.Fatalf("headers %v, want %v", headers, tt.headers)
+			}
+			for key, values := range tt.headers {
+				if strings.Join(headers[key], ",") != strings.Join(values, ",") {
+					t.Errorf("header %s is %v, want %v", key, headers[key], values)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONHeadersInvalid(t *testing.T) {
+	var record replayRecord
+	if err := json.Unmarshal([]byte(`{"payload": 1, "headers": {"X-Retries": 3}}`), &record); err == nil {
+		t.Error("numeric header accepted")
+	}
+}
+
+func TestJSONHeadersFor(t *testing.T) {
+	cmd := Command{Headers: func(connectordata ConnectorMetadata) http.Header {
+		return http.Header{
+			"Topic":     {connectordata.Topic},
+			"RespTopic": {connectordata.ResponseTopic},
+		}
+	}}
+	headers := jsonHeadersFor(cmd, ConnectorMetadata{Topic: "orders", ResponseTopic: "responses"}, http.Header{"Resptopic": {"replies"}})
+
+	if headers.Get("Topic") != "orders" {
+		t.Errorf("connector header Topic is %q", headers.Get("Topic"))
+	}
+	if _, ok := headers["RespTopic"]; ok || headers.Get("Resptopic") != "replies" {
+		t.Errorf("recorded header did not replace the connector header: %v", headers)
+	}
+	if headers := jsonHeadersFor(Command{}, ConnectorMetadata{}, http.Header{"X-Id": {"1"}}); headers.Get("X-Id") != "1" {
+		t.Errorf("headers %v of a connector without headers", headers)
+	}
+}
+
+func TestReplayFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Topic") != "orders" {
+			http.Error(w, "missing topic", http.StatusBadRequest)
+			return
+		}
+		if string(body) == "fail" {
+			http.Error(w, "rejected", http.StatusUnprocessableEntity)
+			return
+		}
+		_, _ = w.Write(append([]byte("echo "), body...))
+	}))
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "errors.jsonl")
+	records := strings.Join([]string{
+		`{"payload": "first"}`,
+		``,
+		`{"FunctionHTTPRequest": {"Message": "second", "Headers": {"Topic": ["orders"]}}}`,
+		`{"payload": "fail"}`,
+		`not json`,
+	}, "\n")
+	if err := os.WriteFile(file, []byte(records), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	r := replayer{
+		cmd: Command{Headers: func(connectordata ConnectorMetadata) http.Header {
+			return http.Header{"Topic": {connectordata.Topic}}
+		}},
+		connectordata: ConnectorMetadata{HTTPEndpoint: srv.URL, Topic: "orders"},
+		logger:        zap.NewNop(),
+		out:           &out,
+		printResponse: true,
+	}
+	if err := r.replayFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.succeeded != 2 || r.failed != 2 {
+		t.Errorf("%d records succeeded and %d failed, want 2 and 2:\n%s", r.succeeded, r.failed, out.String())
+	}
+	for _, want := range []string{file + ":1: 200 OK", "echo first", "echo second", file + ":4: failed", file + ":5: invalid record"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestReplayFileMissing(t *testing.T) {
+	r := replayer{logger: zap.NewNop(), out: io.Discard}
+	if err := r.replayFile(filepath.Join(t.TempDir(), "missing.jsonl")); err == nil {
+		t.Error("missing file replayed")
+	}
+}
+
+func TestReplayMetadata(t *testing.T) {
+	// Replaying only needs the endpoint, not the topics of the connector
+	for _, key := range []string{"TOPIC", "RESPONSE_TOPIC", "ERROR_TOPIC", "SOURCE_NAME"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("HTTP_ENDPOINT", "http://function.default")
+	if _, err := parseConnectorMetadata("HTTP_ENDPOINT"); err != nil {
+		t.Errorf("metadata with only HTTP_ENDPOINT rejected: %v", err)
+	}
+
+	t.Setenv("HTTP_ENDPOINT", "")
+	if _, err := parseConnectorMetadata("HTTP_ENDPOINT"); err == nil {
+		t.Error("metadata without HTTP_ENDPOINT accepted")
+	}
+}
@@ -0,0 +1,97 @@
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Response headers the function can return to control where its response is published
+const (
+	// HeaderResponseTopic publishes the response to another topic, which must be allowed
+	// by RESPONSE_TOPIC_ALLOWLIST
+	HeaderResponseTopic = "KEDA-Response-Topic"
+	// HeaderResponseKey publishes the response with another key
+	HeaderResponseKey = "KEDA-Response-Key"
+	// HeaderDropResponse set to true acknowledges the message without publishing the response
+	HeaderDropResponse = "KEDA-Drop-Response"
+
+	// HeaderFunctionError is set on replies carrying the error envelope of a failed invocation
+	HeaderFunctionError = "KEDA-Function-Error"
+)
+
+// responseDestination is where the response of a message is published
+type responseDestination struct {
+	topic string
+	key   string
+	drop  bool
+	// split is the format of a response published as several messages, empty if it is not split
+	split string
+}
+
+// parseTopicAllowlist parses the comma separated topic patterns of RESPONSE_TOPIC_ALLOWLIST
+func parseTopicAllowlist(raw string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(raw, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q in RESPONSE_TOPIC_ALLOWLIST: %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// topicAllowed reports whether the function may publish its response to topic. The configured
+// response topic is always allowed, since functions echoing the KEDA-Response-Topic request
+// header return it.
+func (data ConnectorMetadata) topicAllowed(topic string) bool {
+	if topic == data.ResponseTopic {
+		return true
+	}
+	for _, pattern := range data.ResponseTopicAllowlist {
+		if ok, _ := path.Match(pattern, topic); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// responseDestination returns where the response is published according to the headers
+// returned by the function. The reserved headers are removed from headers.
+func (data ConnectorMetadata) responseDestination(key string, headers http.Header) (responseDestination, error) {
+	dest := responseDestination{topic: data.ResponseTopic, key: key}
+
+	if drop := headers.Get(HeaderDropResponse); drop != "" {
+		var err error
+		dest.drop, err = strconv.ParseBool(drop)
+		if err != nil {
+			return dest, fmt.Errorf("invalid %s header %q returned by the function", HeaderDropResponse, drop)
+		}
+	}
+	if topic := headers.Get(HeaderResponseTopic); topic != "" {
+		if !data.topicAllowed(topic) {
+			return dest, fmt.Errorf("response topic %q returned by the function is not allowed by RESPONSE_TOPIC_ALLOWLIST", topic)
+		}
+		dest.topic = topic
+	}
+	if values, ok := headers[http.CanonicalHeaderKey(HeaderResponseKey)]; ok && len(values) > 0 {
+		dest.key = values[0]
+	}
+	if split := headers.Get(HeaderSplitResponse); split != "" {
+		if !validSplitFormat(split) {
+			return dest, fmt.Errorf("invalid %s header %q returned by the function, must be %s, %s or %s", HeaderSplitResponse, split, SplitArray, SplitNDJSON, SplitMessages)
+		}
+		dest.split = split
+	}
+
+	headers.Del(HeaderDropResponse)
+	headers.Del(HeaderResponseTopic)
+	headers.Del(HeaderResponseKey)
+	headers.Del(HeaderSplitResponse)
+	return dest, nil
+}
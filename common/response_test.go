@@ -0,0 +1,141 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestParseTopicAllowlist(t *testing.T) {
+	patterns, err := parseTopicAllowlist(" orders-*, ,audit ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(patterns, []string{"orders-*", "audit"}) {
+		t.Errorf("patterns %v", patterns)
+	}
+	if _, err := parseTopicAllowlist("orders-["); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
+
+func TestTopicAllowed(t *testing.T) {
+	data := ConnectorMetadata{ResponseTopic: "responses", ResponseTopicAllowlist: []string{"orders-*", "audit"}}
+	tests := []struct {
+		topic   string
+		allowed bool
+	}{
+		{topic: "responses", allowed: true},
+		{topic: "orders-eu", allowed: true},
+		{topic: "audit", allowed: true},
+		{topic: "audit-eu"},
+		{topic: "payments"},
+	}
+	for _, tt := range tests {
+		if allowed := data.topicAllowed(tt.topic); allowed != tt.allowed {
+			t.Errorf("topic %s allowed %v, want %v", tt.topic, allowed, tt.allowed)
+		}
+	}
+	if (ConnectorMetadata{}).topicAllowed("orders") {
+		t.Error("topic allowed without RESPONSE_TOPIC_ALLOWLIST")
+	}
+}
+
+func TestResponseDestination(t *testing.T) {
+	data := ConnectorMetadata{ResponseTopic: "responses", ResponseTopicAllowlist: []string{"orders-*"}}
+	tests := []struct {
+		name    string
+		headers http.Header
+		want    responseDestination
+		err     bool
+	}{
+		{name: "defaults", headers: http.Header{}, want: responseDestination{topic: "responses", key: "key"}},
+		{
+			name:    "topic and key",
+			headers: http.Header{"Keda-Response-Topic": {"orders-eu"}, "Keda-Response-Key": {"order-1"}},
+			want:    responseDestination{topic: "orders-eu", key: "order-1"},
+		},
+		{name: "empty key", headers: http.Header{"Keda-Response-Key": {""}}, want: responseDestination{topic: "responses"}},
+		{name: "dropped", headers: http.Header{"Keda-Drop-Response": {"true"}}, want: responseDestination{topic: "responses", key: "key", drop: true}},
+		{name: "topic not allowed", headers: http.Header{"Keda-Response-Topic": {"payments"}}, err: true},
+		{name: "invalid drop", headers: http.Header{"Keda-Drop-Response": {"maybe"}}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := tt.headers.Clone()
+			headers.Set("X-Trace", "1")
+			dest, err := data.responseDestination("key", headers)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if dest != tt.want {
+				t.Errorf("destination %+v, want %+v", dest, tt.want)
+			}
+			for _, key := range []string{HeaderResponseTopic, HeaderResponseKey, HeaderDropResponse} {
+				if _, ok := headers[http.CanonicalHeaderKey(key)]; ok {
+					t.Errorf("reserved header %s not removed", key)
+				}
+			}
+			if headers.Get("X-Trace") != "1" {
+				t.Error("function header removed")
+			}
+		})
+	}
+}
+
+func TestPipelineResponseRouting(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers http.Header
+		// topic is the topic a message is published to, empty if none is
+		topic string
+		key   string
+	}{
+		{name: "response topic", headers: http.Header{"Keda-Response-Topic": {"orders-eu"}, "Keda-Response-Key": {"eu"}}, topic: "orders-eu", key: "eu"},
+		{name: "response dropped", headers: http.Header{"Keda-Drop-Response": {"1"}}},
+		{name: "topic not allowed", headers: http.Header{"Keda-Response-Topic": {"payments"}}, topic: "errors", key: "key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for key, values := range tt.headers {
+					w.Header()[key] = values
+				}
+				_, _ = w.Write([]byte("response"))
+			}))
+			defer srv.Close()
+
+			sink := &recordingSink{}
+			p := newTestPipeline(t, ConnectorMetadata{
+				HTTPEndpoint:           srv.URL,
+				ResponseTopic:          "responses",
+				ErrorTopic:             "errors",
+				ResponseTopicAllowlist: []string{"orders-*"},
+			}, sink)
+			msg := &testMessage{body: []byte("message"), key: "key"}
+			p.Handle(context.Background(), msg)
+
+			published := sink.published()
+			if tt.topic == "" {
+				if len(published) > 0 {
+					t.Errorf("published %d messages, want none", len(published))
+				}
+			} else if len(published) != 1 || published[0].Topic != tt.topic || published[0].Key != tt.key {
+				t.Errorf("published %+v, want one message to %s with key %q", published, tt.topic, tt.key)
+			} else if published[0].Headers.Get(HeaderResponseTopic) != "" {
+				t.Error("reserved header published with the response")
+			}
+			if acks, _ := msg.outcome(); tt.topic != "errors" && acks != 1 {
+				t.Errorf("message acknowledged %d times", acks)
+			}
+		})
+	}
+}
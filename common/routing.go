@@ -0,0 +1,241 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Route sends the messages matching all of its conditions to another endpoint and,
+	// optionally, publishes their responses and errors to other topics. The endpoint is
+	// either a single URL in HTTPEndpoint, used as is like HTTP_ENDPOINT, or the endpoint
+	// sets of HTTPEndpoints the messages are fanned out to like HTTP_ENDPOINTS.
+	Route struct {
+		Name          string           `json:"name"`
+		When          []RouteCondition `json:"when"`
+		HTTPEndpoint  string           `json:"httpEndpoint,omitempty"`
+		HTTPEndpoints []string         `json:"httpEndpoints,omitempty"`
+		ResponseTopic string           `json:"responseTopic,omitempty"`
+		ErrorTopic    string           `json:"errorTopic,omitempty"`
+
+		// endpoint and endpoints replace HTTP_ENDPOINT and HTTP_ENDPOINTS for the route
+		endpoint  string
+		endpoints []*EndpointSet
+	}
+
+	// RouteCondition matches a header or a field of a JSON payload. The value is compared
+	// with Equals or Matches, without either the condition only checks it is present.
+	RouteCondition struct {
+		// Header is the name of a header of the message, matched case-insensitively
+		Header string `json:"header,omitempty"`
+		// Field is the dot separated path of a field of the JSON payload, e.g. event.type or items.0.id
+		Field   string `json:"field,omitempty"`
+		Equals  string `json:"equals,omitempty"`
+		Matches string `json:"matches,omitempty"`
+
+		pattern *regexp.Regexp
+	}
+
+	// RoutingTable selects the route of every message, routes are evaluated in order and the
+	// first one matching is used. Messages matching no route use the connector configuration.
+	RoutingTable struct {
+		Routes []*Route
+		// payloadFields is true if any condition matches a field of the payload
+		payloadFields bool
+	}
+)
+
+// parseRoutingTable reads the routing table from ROUTES, or the file named by ROUTES_FILE.
+// It returns nil when neither is set.
+func parseRoutingTable() (*RoutingTable, error) {
+	data := []byte(os.Getenv("ROUTES"))
+	if file := os.Getenv("ROUTES_FILE"); file != "" {
+		if len(data) > 0 {
+			return nil, errors.New("only one of ROUTES and ROUTES_FILE can be set")
+		}
+		var err error
+		data, err = os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ROUTES_FILE: %w", err)
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	table := &RoutingTable{}
+	if err := json.Unmarshal(data, &table.Routes); err != nil {
+		return nil, fmt.Errorf("failed to parse routes: %w", err)
+	}
+	for i, route := range table.Routes {
+		if route.Name == "" {
+			route.Name = strconv.Itoa(i)
+		}
+		if err := route.parseEndpoints(); err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.Name, err)
+		}
+
+		var err error
+		for j := range route.When {
+			cond := &route.When[j]
+			if (cond.Header == "") == (cond.Field == "") {
+				return nil, fmt.Errorf("route %s: every condition must have either a header or a field", route.Name)
+			}
+			if cond.Equals != "" && cond.Matches != "" {
+				return nil, fmt.Errorf("route %s: a condition can have either equals or matches", route.Name)
+			}
+			if cond.Matches != "" {
+				cond.pattern, err = regexp.Compile(cond.Matches)
+				if err != nil {
+					return nil, fmt.Errorf("route %s: %w", route.Name, err)
+				}
+			}
+			if cond.Field != "" {
+				table.payloadFields = true
+			}
+		}
+	}
+	return table, nil
+}
+
+// parseEndpoints parses the endpoint of the route, which is either a single URL in
+// httpEndpoint or a list of endpoint sets in httpEndpoints
+func (r *Route) parseEndpoints() error {
+	switch {
+	case r.HTTPEndpoint != "" && len(r.HTTPEndpoints) > 0:
+		return errors.New("only one of httpEndpoint and httpEndpoints can be set")
+	case r.HTTPEndpoint != "":
+		if err := validateEndpointTemplate(r.HTTPEndpoint); err != nil {
+			return fmt.Errorf("failed to parse httpEndpoint: %w", err)
+		}
+		r.endpoint = r.HTTPEndpoint
+		r.endpoints = []*EndpointSet{singleEndpointSet(r.HTTPEndpoint)}
+		return nil
+	case len(r.HTTPEndpoints) > 0:
+		ejectAfter, ejectDuration, err := parseEjectSettings()
+		if err != nil {
+			return err
+		}
+		for _, spec := range r.HTTPEndpoints {
+			set, err := ParseEndpointSet(strings.TrimSpace(spec), ejectAfter, ejectDuration)
+			if err != nil {
+				return fmt.Errorf("failed to parse httpEndpoints: %w", err)
+			}
+			r.endpoints = append(r.endpoints, set)
+		}
+		r.endpoint = strings.Join(r.HTTPEndpoints, ",")
+		return nil
+	}
+	return errors.New("no httpEndpoint or httpEndpoints given")
+}
+
+// Route returns the name of the route matching the message and data with the endpoint and
+// topics of the route. It returns data unchanged and an empty name when no route matches.
+func (t *RoutingTable) Route(body []byte, headers http.Header, data ConnectorMetadata) (string, ConnectorMetadata) {
+	if t == nil {
+		return "", data
+	}
+
+	// The payload is decoded once for all conditions, it is left nil if it is not JSON
+	var payload any
+	if t.payloadFields {
+		_ = json.Unmarshal(body, &payload)
+	}
+
+	for _, route := range t.Routes {
+		if !route.matches(headers, payload) {
+			continue
+		}
+		data.HTTPEndpoint = route.endpoint
+		data.HTTPEndpoints = route.endpoints
+		if route.ResponseTopic != "" {
+			data.ResponseTopic = route.ResponseTopic
+		}
+		if route.ErrorTopic != "" {
+			data.ErrorTopic = route.ErrorTopic
+		}
+		return route.Name, data
+	}
+	return "", data
+}
+
+func (r *Route) matches(headers http.Header, payload any) bool {
+	for i := range r.When {
+		if !r.When[i].matches(headers, payload) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *RouteCondition) matches(headers http.Header, payload any) bool {
+	var values []string
+	if c.Header != "" {
+		// Connector headers are not always canonical, e.g. RespTopic for NATS
+		for key, vals := range headers {
+			if strings.EqualFold(key, c.Header) {
+				values = append(values, vals...)
+			}
+		}
+	} else if value, ok := jsonField(payload, c.Field); ok {
+		values = []string{value}
+	}
+
+	for _, value := range values {
+		switch {
+		case c.pattern != nil:
+			if c.pattern.MatchString(value) {
+				return true
+			}
+		case c.Equals != "":
+			if value == c.Equals {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// jsonField returns the value of the field at path as a string. Objects and arrays are
+// returned as JSON.
+func jsonField(payload any, path string) (string, bool) {
+	value := payload
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]any:
+			var ok bool
+			if value, ok = v[key]; !ok {
+				return "", false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", false
+			}
+			value = v[i]
+		default:
+			return "", false
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return string(data), true
+	}
+}
@@ -0,0 +1,176 @@
+package common
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testRoutes = `[
+	{"name": "eu", "when": [{"header": "KEDA-Region", "equals": "eu"}], "httpEndpoint": "http://eu", "responseTopic": "eu-responses"},
+	{"name": "refunds", "when": [{"field": "event.type", "matches": "^refund\\."}, {"field": "items.0.id"}], "httpEndpoint": "http://refunds", "errorTopic": "refund-errors"},
+	{"when": [{"field": "priority", "equals": "1"}], "httpEndpoint": "http://urgent"}
+]`
+
+func TestRoutingTableRoute(t *testing.T) {
+	t.Setenv("ROUTES", testRoutes)
+	table, err := parseRoutingTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := ConnectorMetadata{HTTPEndpoint: "http://default", ResponseTopic: "responses", ErrorTopic: "errors"}
+
+	tests := []struct {
+		name          string
+		body          string
+		headers       http.Header
+		route         string
+		endpoint      string
+		responseTopic string
+		errorTopic    string
+	}{
+		{
+			name:     "no match",
+			body:     `{"event": {"type": "order.created"}}`,
+			endpoint: "http://default", responseTopic: "responses", errorTopic: "errors",
+		},
+		{
+			name:    "header matched case-insensitively",
+			headers: http.Header{"Keda-Region": {"eu"}},
+			route:   "eu", endpoint: "http://eu", responseTopic: "eu-responses", errorTopic: "errors",
+		},
+		{
+			name:    "non canonical header",
+			headers: http.Header{"KEDA-Region": {"eu"}},
+			route:   "eu", endpoint: "http://eu", responseTopic: "eu-responses", errorTopic: "errors",
+		},
+		{
+			name:  "all conditions match",
+			body:  `{"event": {"type": "refund.created"}, "items": [{"id": 7}]}`,
+			route: "refunds", endpoint: "http://refunds", responseTopic: "responses", errorTopic: "refund-errors",
+		},
+		{
+			name:     "one condition does not match",
+			body:     `{"event": {"type": "refund.created"}, "items": []}`,
+			endpoint: "http://default", responseTopic: "responses", errorTopic: "errors",
+		},
+		{
+			name:    "first matching route wins",
+			body:    `{"event": {"type": "refund.created"}, "items": [{"id": 7}]}`,
+			headers: http.Header{"Keda-Region": {"eu"}},
+			route:   "eu", endpoint: "http://eu", responseTopic: "eu-responses", errorTopic: "errors",
+		},
+		{
+			name:  "non string field compared as JSON",
+			body:  `{"priority": 1}`,
+			route: "2", endpoint: "http://urgent", responseTopic: "responses", errorTopic: "errors",
+		},
+		{
+			name:     "payload not JSON",
+			body:     `priority=1`,
+			endpoint: "http://default", responseTopic: "responses", errorTopic: "errors",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route, routed := table.Route([]byte(tt.body), tt.headers, data)
+			if route != tt.route {
+				t.Errorf("route %q, want %q", route, tt.route)
+			}
+			if routed.HTTPEndpoint != tt.endpoint || routed.ResponseTopic != tt.responseTopic || routed.ErrorTopic != tt.errorTopic {
+				t.Errorf("endpoint %s, topics %s and %s, want %s, %s and %s",
+					routed.HTTPEndpoint, routed.ResponseTopic, routed.ErrorTopic, tt.endpoint, tt.responseTopic, tt.errorTopic)
+			}
+		})
+	}
+}
+
+func TestParseRoutingTableErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes string
+	}{
+		{name: "not JSON", routes: `{"name": "eu"}`},
+		{name: "no endpoint", routes: `[{"when": [{"header": "A"}]}]`},
+		{name: "header and field", routes: `[{"when": [{"header": "A", "field": "a"}], "httpEndpoint": "http://a"}]`},
+		{name: "neither header nor field", routes: `[{"when": [{"equals": "a"}], "httpEndpoint": "http://a"}]`},
+		{name: "equals and matches", routes: `[{"when": [{"header": "A", "equals": "a", "matches": "a"}], "httpEndpoint": "http://a"}]`},
+		{name: "invalid pattern", routes: `[{"when": [{"header": "A", "matches": "("}], "httpEndpoint": "http://a"}]`},
+		{name: "invalid endpoint template", routes: `[{"httpEndpoint": "http://a/{}"}]`},
+		{name: "invalid endpoint set", routes: `[{"httpEndpoints": ["http://a;weight=0"]}]`},
+		{name: "both endpoint settings", routes: `[{"httpEndpoint": "http://a", "httpEndpoints": ["http://b"]}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ROUTES", tt.routes)
+			if _, err := parseRoutingTable(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestRouteEndpoints(t *testing.T) {
+	t.Setenv("ENDPOINT_EJECT_AFTER", "1")
+	t.Setenv("ENDPOINT_EJECT_DURATION", "1m")
+	t.Setenv("ROUTES", `[
+		{"name": "single", "when": [{"header": "A"}], "httpEndpoint": "http://fn?ids=1,2"},
+		{"name": "fan-out", "httpEndpoints": ["http://audit", "http://blue;weight=9|http://green;weight=1"]}
+	]`)
+	table, err := parseRoutingTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A single endpoint is used as is, commas included
+	_, routed := table.Route(nil, http.Header{"A": {"1"}}, ConnectorMetadata{})
+	if routed.HTTPEndpoint != "http://fn?ids=1,2" || len(routed.HTTPEndpoints) != 1 || routed.HTTPEndpoints[0].String() != "http://fn?ids=1,2" {
+		t.Errorf("single endpoint routed to %s with sets %v", routed.HTTPEndpoint, routed.HTTPEndpoints)
+	}
+
+	_, routed = table.Route(nil, nil, ConnectorMetadata{})
+	if routed.HTTPEndpoint != "http://audit,http://blue;weight=9|http://green;weight=1" || len(routed.HTTPEndpoints) != 2 {
+		t.Fatalf("fan-out routed to %s with sets %v", routed.HTTPEndpoint, routed.HTTPEndpoints)
+	}
+	set := routed.HTTPEndpoints[1]
+	if len(set.members) != 2 || set.ejectAfter != 1 || set.ejectDuration != time.Minute {
+		t.Errorf("endpoint set %s with %d members ejected after %d errors for %v", set, len(set.members), set.ejectAfter, set.ejectDuration)
+	}
+}
+
+func TestRoutesFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "routes.json")
+	if err := os.WriteFile(file, []byte(testRoutes), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ROUTES", "")
+	t.Setenv("ROUTES_FILE", file)
+	table, err := parseRoutingTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.Routes) != 3 {
+		t.Errorf("%d routes read from ROUTES_FILE, want 3", len(table.Routes))
+	}
+
+	t.Setenv("ROUTES", testRoutes)
+	if _, err := parseRoutingTable(); err == nil {
+		t.Error("both ROUTES and ROUTES_FILE accepted")
+	}
+
+	t.Setenv("ROUTES", "")
+	t.Setenv("ROUTES_FILE", "")
+	if table, err := parseRoutingTable(); table != nil || err != nil {
+		t.Errorf("routing table %v, %v without routes", table, err)
+	}
+}
+
+func TestNilRoutingTable(t *testing.T) {
+	var table *RoutingTable
+	data := ConnectorMetadata{HTTPEndpoint: "http://default"}
+	if route, routed := table.Route(nil, nil, data); route != "" || routed.HTTPEndpoint != "http://default" {
+		t.Errorf("nil table routed to %q with endpoint %s", route, routed.HTTPEndpoint)
+	}
+}
@@ -0,0 +1,122 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// replyMessage is a message of a broker with request/reply semantics
+type replyMessage struct {
+	*testMessage
+	replyTo  string
+	replyErr error
+
+	mu      sync.Mutex
+	replies []SinkMessage
+}
+
+func (m *replyMessage) ReplyTo() string { return m.replyTo }
+
+func (m *replyMessage) Reply(_ context.Context, body []byte, headers http.Header) error {
+	if m.replyErr != nil {
+		return m.replyErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replies = append(m.replies, SinkMessage{Topic: m.replyTo, Body: body, Headers: headers})
+	return nil
+}
+
+func TestPipelineReply(t *testing.T) {
+	tests := []struct {
+		name     string
+		rpcMode  bool
+		replyTo  string
+		status   int
+		headers  http.Header
+		replyErr error
+		// reply is the body of the reply, empty if there is none
+		reply string
+		// topic is the topic a message is published to, empty if none is
+		topic string
+		acks  int
+		nacks int
+	}{
+		{name: "reply", rpcMode: true, replyTo: "inbox", status: http.StatusOK, reply: "response", acks: 1},
+		{name: "RPC mode disabled", replyTo: "inbox", status: http.StatusOK, topic: "responses", acks: 1},
+		{name: "no reply address", rpcMode: true, status: http.StatusOK, topic: "responses", acks: 1},
+		{name: "reply dropped", rpcMode: true, replyTo: "inbox", status: http.StatusOK, headers: http.Header{"Keda-Drop-Response": {"true"}}, acks: 1},
+		{name: "reply failed", rpcMode: true, replyTo: "inbox", status: http.StatusOK, replyErr: errTestPublish, nacks: 1},
+		{name: "function error", rpcMode: true, replyTo: "inbox", status: http.StatusInternalServerError, reply: "error", topic: "errors", nacks: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for key, values := range tt.headers {
+					w.Header()[key] = values
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte("response"))
+			}))
+			defer srv.Close()
+
+			sink := &recordingSink{}
+			p := newTestPipeline(t, ConnectorMetadata{
+				HTTPEndpoint:  srv.URL,
+				ResponseTopic: "responses",
+				ErrorTopic:    "errors",
+				RPCMode:       tt.rpcMode,
+			}, sink)
+			msg := &replyMessage{testMessage: &testMessage{body: []byte("request")}, replyTo: tt.replyTo, replyErr: tt.replyErr}
+			p.Handle(context.Background(), msg)
+
+			if acks, nacks := msg.outcome(); acks != tt.acks || nacks != tt.nacks {
+				t.Errorf("%d acks and %d nacks, want %d and %d", acks, nacks, tt.acks, tt.nacks)
+			}
+			switch {
+			case tt.reply == "":
+				if len(msg.replies) > 0 {
+					t.Errorf("replied %q, want no reply", msg.replies[0].Body)
+				}
+			case len(msg.replies) != 1:
+				t.Errorf("%d replies, want 1", len(msg.replies))
+			case tt.reply == "error":
+				// Brokers receive the header as written, it is not canonicalized
+				if values := msg.replies[0].Headers[HeaderFunctionError]; len(values) != 1 || values[0] != "true" {
+					t.Errorf("error replied without %s", HeaderFunctionError)
+				}
+			case string(msg.replies[0].Body) != tt.reply:
+				t.Errorf("replied %q, want %q", msg.replies[0].Body, tt.reply)
+			}
+
+			published := sink.published()
+			if tt.topic == "" {
+				if len(published) > 0 {
+					t.Errorf("published to %s, want no publication", published[0].Topic)
+				}
+			} else if len(published) != 1 || published[0].Topic != tt.topic {
+				t.Errorf("published %d messages, want one to %s", len(published), tt.topic)
+			}
+		})
+	}
+}
+
+func TestParseRPCMode(t *testing.T) {
+	t.Setenv("HTTP_ENDPOINT", "http://function")
+	t.Setenv("RPC_MODE", "true")
+	data, err := parseConnectorMetadata("HTTP_ENDPOINT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !data.RPCMode {
+		t.Error("RPC_MODE not enabled")
+	}
+
+	t.Setenv("RPC_MODE", "sometimes")
+	if _, err := parseConnectorMetadata("HTTP_ENDPOINT"); err == nil {
+		t.Error("invalid RPC_MODE accepted")
+	}
+}
@@ -0,0 +1,145 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+type (
+	// Message is a single message received from a Source
+	Message interface {
+		// Body returns the payload of the message
+		Body() []byte
+		// Headers returns the headers sent to the function along with the payload
+		Headers() http.Header
+		// Key returns the partitioning or ordering key of the message, empty if the broker has none
+		Key() string
+		// Ack marks the message as successfully processed
+		Ack() error
+		// Nack marks the message as failed, redelivery follows the semantics of the broker
+		Nack() error
+	}
+
+	// PositionedMessage is implemented by messages which know their position in the broker,
+	// such as the partition and offset of a Kafka record
+	PositionedMessage interface {
+		Message
+		// Position returns the broker coordinates of the message
+		Position() map[string]string
+	}
+
+	// ReplyableMessage is implemented by messages of brokers with request/reply semantics.
+	// In RPC mode the response is published to the reply address of the message instead
+	// of the response topic.
+	ReplyableMessage interface {
+		Message
+		// ReplyTo returns the reply address of the message, empty if the sender expects no reply
+		ReplyTo() string
+		// Reply publishes body to the reply address, preserving the correlation id of the message
+		Reply(ctx context.Context, body []byte, headers http.Header) error
+	}
+
+	// DeferrableMessage is implemented by messages which can be processed again later without
+	// blocking the source, e.g. by producing them to a retry topic. The error of a message which
+	// has been deferred is not published to the error topic.
+	DeferrableMessage interface {
+		Message
+		// Defer schedules the message to be processed again. It returns false when the message
+		// has no retries left and its error has to be handled by the pipeline.
+		Defer(ctx context.Context, err error) (bool, error)
+	}
+
+	// MessageHandler processes a message received from a Source
+	MessageHandler func(ctx context.Context, msg Message)
+
+	// Source consumes messages from a broker and passes them to handler until ctx is cancelled
+	Source interface {
+		Consume(ctx context.Context, handler MessageHandler) error
+	}
+
+	// SinkMessage is a message published to a Sink
+	SinkMessage struct {
+		Topic   string
+		Key     string
+		Body    []byte
+		Headers http.Header
+		// Durable is set when the message being processed is only acknowledged once msg has
+		// been published, sinks publishing asynchronously must wait for the broker to accept it
+		Durable bool
+	}
+
+	// Sink publishes messages to a broker
+	Sink interface {
+		Publish(ctx context.Context, msg SinkMessage) error
+		Close() error
+	}
+
+	// BatchSink is implemented by sinks which can publish several messages atomically
+	BatchSink interface {
+		Sink
+		// PublishBatch publishes either all of msgs or none of them
+		PublishBatch(ctx context.Context, msgs []SinkMessage) error
+	}
+
+	// SizeLimitedSink is implemented by sinks of brokers with a maximum message size,
+	// responses exceeding it are published to the error topic instead
+	SizeLimitedSink interface {
+		Sink
+		// MaxMessageSize returns the maximum size in bytes of a message
+		MaxMessageSize() int
+		// Size returns the size in bytes of msg counted against MaxMessageSize, which only
+		// includes the parts of msg the broker receives, see SinkMessage.Size
+		Size(msg SinkMessage) int
+	}
+
+	// SinkFactory creates a Sink from a URL such as kafka://broker:9092
+	SinkFactory func(ctx context.Context, u *url.URL, connectordata ConnectorMetadata, logger *zap.Logger) (Sink, error)
+)
+
+var (
+	sinkFactoriesMu sync.RWMutex
+	sinkFactories   = map[string]SinkFactory{}
+)
+
+// RegisterSink makes a sink available for the given URL scheme. It is meant to be called from init.
+func RegisterSink(scheme string, factory SinkFactory) {
+	sinkFactoriesMu.Lock()
+	defer sinkFactoriesMu.Unlock()
+	if _, ok := sinkFactories[scheme]; ok {
+		panic(fmt.Sprintf("sink already registered for scheme %q", scheme))
+	}
+	sinkFactories[scheme] = factory
+}
+
+// NewSink creates a Sink from the given URL using the factory registered for its scheme
+func NewSink(ctx context.Context, rawURL string, connectordata ConnectorMetadata, logger *zap.Logger) (Sink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sink url %q: %w", rawURL, err)
+	}
+
+	sinkFactoriesMu.RLock()
+	factory, ok := sinkFactories[u.Scheme]
+	sinkFactoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no sink registered for scheme %q, available: %v", u.Scheme, sinkSchemes())
+	}
+	return factory(ctx, u, connectordata, logger)
+}
+
+func sinkSchemes() []string {
+	sinkFactoriesMu.RLock()
+	defer sinkFactoriesMu.RUnlock()
+	schemes := make([]string, 0, len(sinkFactories))
+	for scheme := range sinkFactories {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
@@ -0,0 +1,102 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+)
+
+// HeaderSplitResponse returned by the function publishes every element of its response as
+// a separate message
+const HeaderSplitResponse = "KEDA-Split-Response"
+
+// Formats of split responses
+const (
+	// SplitArray splits a JSON array, every element is published as a message
+	SplitArray = "array"
+	// SplitNDJSON splits newline delimited JSON, every line is published as a message
+	SplitNDJSON = "ndjson"
+	// SplitMessages splits a JSON array of objects with the value, key and headers of every message
+	SplitMessages = "messages"
+)
+
+// splitMessage is an element of a response split with the messages format
+type splitMessage struct {
+	Value   json.RawMessage `json:"value"`
+	Key     *string         `json:"key"`
+	Headers jsonHeaders     `json:"headers"`
+}
+
+func validSplitFormat(format string) bool {
+	return format == SplitArray || format == SplitNDJSON || format == SplitMessages
+}
+
+// messages returns the messages the response is published as, a single message unless the
+// function asked for its response to be split
+func (dest responseDestination) messages(body []byte, headers http.Header) ([]SinkMessage, error) {
+	if dest.split == "" {
+		return []SinkMessage{{Topic: dest.topic, Key: dest.key, Body: body, Headers: headers}}, nil
+	}
+
+	// Elements which are JSON strings are published unquoted, other values are published as JSON
+	var elements []json.RawMessage
+	switch dest.split {
+	case SplitArray, SplitMessages:
+		if err := json.Unmarshal(body, &elements); err != nil {
+			return nil, fmt.Errorf("failed to split response, it is not a JSON array: %w", err)
+		}
+	case SplitNDJSON:
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		for {
+			var element json.RawMessage
+			err := decoder.Decode(&element)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to split response, it is not newline delimited JSON: %w", err)
+			}
+			elements = append(elements, element)
+		}
+	}
+
+	msgs := make([]SinkMessage, 0, len(elements))
+	for i, element := range elements {
+		msg := SinkMessage{Topic: dest.topic, Key: dest.key, Headers: headers}
+		if dest.split == SplitMessages {
+			var m splitMessage
+			if err := json.Unmarshal(element, &m); err != nil {
+				return nil, fmt.Errorf("failed to split response, element %d is not a message: %w", i, err)
+			}
+			if m.Value == nil {
+				return nil, fmt.Errorf("failed to split response, element %d has no value", i)
+			}
+			element = m.Value
+			if m.Key != nil {
+				msg.Key = *m.Key
+			}
+			if len(m.Headers) > 0 {
+				msg.Headers = maps.Clone(headers)
+				if msg.Headers == nil {
+					msg.Headers = http.Header{}
+				}
+				for k, v := range m.Headers {
+					msg.Headers[http.CanonicalHeaderKey(k)] = v
+				}
+			}
+		}
+
+		var value string
+		if err := json.Unmarshal(element, &value); err == nil {
+			msg.Body = []byte(value)
+		} else {
+			msg.Body = element
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
@@ -0,0 +1,173 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseDestinationMessages(t *testing.T) {
+	headers := http.Header{"Content-Type": {"application/json"}}
+	type message struct {
+		key    string
+		body   string
+		header string
+	}
+	tests := []struct {
+		name  string
+		split string
+		body  string
+		want  []message
+		err   bool
+	}{
+		{
+			name: "not split",
+			body: `[1, 2]`,
+			want: []message{{key: "k", body: `[1, 2]`}},
+		},
+		{
+			name:  "array",
+			split: SplitArray,
+			body:  `["a", {"b": 1}, 3]`,
+			want:  []message{{key: "k", body: "a"}, {key: "k", body: `{"b": 1}`}, {key: "k", body: "3"}},
+		},
+		{
+			name:  "empty array",
+			split: SplitArray,
+			body:  `[]`,
+		},
+		{
+			name:  "array of something else",
+			split: SplitArray,
+			body:  `{"a": 1}`,
+			err:   true,
+		},
+		{
+			name:  "ndjson",
+			split: SplitNDJSON,
+			body:  "{\"a\": 1}\n\"b\"\n\n2\n",
+			want:  []message{{key: "k", body: `{"a": 1}`}, {key: "k", body: "b"}, {key: "k", body: "2"}},
+		},
+		{
+			name:  "invalid ndjson",
+			split: SplitNDJSON,
+			body:  "{\"a\": 1}\nb\n",
+			err:   true,
+		},
+		{
+			name:  "messages",
+			split: SplitMessages,
+			body:  `[{"value": "a"}, {"value": {"b": 1}, "key": "other", "headers": {"X-Part": "2"}}]`,
+			want:  []message{{key: "k", body: "a"}, {key: "other", body: `{"b": 1}`, header: "2"}},
+		},
+		{
+			name:  "message without value",
+			split: SplitMessages,
+			body:  `[{"key": "other"}]`,
+			err:   true,
+		},
+		{
+			name:  "message not an object",
+			split: SplitMessages,
+			body:  `["a"]`,
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := responseDestination{topic: "responses", key: "k", split: tt.split}
+			msgs, err := dest.messages([]byte(tt.body), headers)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(msgs) != len(tt.want) {
+				t.Fatalf("%d messages, want %d", len(msgs), len(tt.want))
+			}
+			for i, msg := range msgs {
+				want := tt.want[i]
+				if msg.Topic != "responses" || msg.Key != want.key || string(msg.Body) != want.body {
+					t.Errorf("message %d is %s with key %q on %s, want %s with key %q", i, msg.Body, msg.Key, msg.Topic, want.body, want.key)
+				}
+				if got := msg.Headers.Get("X-Part"); got != want.header {
+					t.Errorf("message %d has X-Part %q, want %q", i, got, want.header)
+				}
+				if msg.Headers.Get("Content-Type") != "application/json" {
+					t.Errorf("message %d lost the response headers", i)
+				}
+			}
+			// The headers of a message must not leak into the response headers
+			if headers.Get("X-Part") != "" {
+				t.Error("response headers modified")
+			}
+		})
+	}
+}
+
+// batchSink records the batches published to it
+type batchSink struct {
+	recordingSink
+	batches [][]SinkMessage
+}
+
+func (s *batchSink) PublishBatch(ctx context.Context, msgs []SinkMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, msgs)
+	return nil
+}
+
+func TestPipelineSplitResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		split   string
+		batches int
+		// published is the number of messages published one by one
+		published int
+		errors    bool
+	}{
+		{name: "split in a batch", split: SplitArray, batches: 1},
+		{name: "split into a single message", split: SplitNDJSON, published: 1},
+		{name: "invalid split format", split: "csv", errors: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `["a", "b", "c"]`
+			if tt.split == SplitNDJSON {
+				body = `"a"`
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(HeaderSplitResponse, tt.split)
+				_, _ = w.Write([]byte(body))
+			}))
+			defer srv.Close()
+
+			sink := &batchSink{}
+			p := newTestPipeline(t, ConnectorMetadata{HTTPEndpoint: srv.URL, ResponseTopic: "responses", ErrorTopic: "errors"}, sink)
+			p.Handle(context.Background(), &testMessage{body: []byte("message")})
+
+			if len(sink.batches) != tt.batches {
+				t.Fatalf("%d batches, want %d", len(sink.batches), tt.batches)
+			}
+			if tt.batches > 0 && len(sink.batches[0]) != 3 {
+				t.Errorf("batch of %d messages, want 3", len(sink.batches[0]))
+			}
+			published := sink.published()
+			if tt.errors {
+				if len(published) != 1 || published[0].Topic != "errors" {
+					t.Errorf("published %+v, want the error", published)
+				}
+				return
+			}
+			if len(published) != tt.published {
+				t.Errorf("%d messages published one by one, want %d", len(published), tt.published)
+			}
+		})
+	}
+}
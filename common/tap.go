@@ -0,0 +1,212 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTapMaxFileSize = 100 * 1024 * 1024
+	defaultTapMaxBodySize = 64 * 1024
+)
+
+type (
+	// Tap writes sampled function invocations as JSONL for debugging. Records have the
+	// payload and headers format read by the replay command.
+	Tap struct {
+		mu          sync.Mutex
+		out         io.Writer
+		file        *os.File
+		path        string
+		size        int64
+		maxFileSize int64
+		maxBodySize int
+		sampleRate  float64
+		redactor    *Redactor
+	}
+
+	// TapRecord is a function invocation written by the Tap
+	TapRecord struct {
+		Time      time.Time         `json:"time"`
+		Source    string            `json:"source"`
+		Position  map[string]string `json:"position,omitempty"`
+		Payload   string            `json:"payload"`
+		Headers   http.Header       `json:"headers"`
+		Truncated bool              `json:"truncated,omitempty"`
+		Latency   float64           `json:"latencyMs"`
+		Response  *TapResponse      `json:"response,omitempty"`
+		Error     string            `json:"error,omitempty"`
+	}
+
+	// TapResponse is the function response of a TapRecord
+	TapResponse struct {
+		StatusCode int         `json:"statusCode"`
+		Headers    http.Header `json:"headers,omitempty"`
+		Body       string      `json:"body"`
+		Truncated  bool        `json:"truncated,omitempty"`
+	}
+)
+
+// NewTapFromEnv creates the Tap configured by the TAP_* environment variables, it returns
+// nil when TAP_OUTPUT is not set:
+//
+//	TAP_OUTPUT          stdout, or the path of the file records are appended to
+//	TAP_SAMPLE_RATE     fraction of the invocations written, between 0 and 1, defaults to 1
+//	TAP_MAX_FILE_SIZE   size in bytes after which the file is rotated to <path>.1
+//	TAP_MAX_BODY_SIZE   size in bytes after which payloads and response bodies are truncated
+//	TAP_REDACT_HEADERS  comma separated headers whose values are redacted
+//	TAP_REDACT_BODY     regular expression whose matches are redacted from bodies
+func NewTapFromEnv() (*Tap, error) {
+	output := os.Getenv("TAP_OUTPUT")
+	if output == "" {
+		return nil, nil
+	}
+
+	t := &Tap{
+		maxFileSize: defaultTapMaxFileSize,
+		maxBodySize: defaultTapMaxBodySize,
+		sampleRate:  1,
+	}
+
+	if v := os.Getenv("TAP_SAMPLE_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("TAP_SAMPLE_RATE must be a number between 0 and 1, got %q", v)
+		}
+		t.sampleRate = rate
+	}
+	if v := os.Getenv("TAP_MAX_FILE_SIZE"); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("TAP_MAX_FILE_SIZE must be a positive number of bytes, got %q", v)
+		}
+		t.maxFileSize = size
+	}
+	if v := os.Getenv("TAP_MAX_BODY_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("TAP_MAX_BODY_SIZE must be a number of bytes, got %q", v)
+		}
+		t.maxBodySize = size
+	}
+
+	redactor, err := NewRedactor(os.Getenv("TAP_REDACT_HEADERS"), os.Getenv("TAP_REDACT_BODY"))
+	if err != nil {
+		return nil, err
+	}
+	t.redactor = redactor
+
+	if output == "stdout" {
+		t.out = os.Stdout
+		return t, nil
+	}
+	t.path = output
+	if err := t.open(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Tap) open() error {
+	file, err := os.OpenFile(t.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open tap file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to open tap file: %w", err)
+	}
+	t.file = file
+	t.out = file
+	t.size = info.Size()
+	return nil
+}
+
+// rotate moves the current file to <path>.1, replacing the previous one, and starts a new file
+func (t *Tap) rotate() error {
+	if err := t.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(t.path, t.path+".1"); err != nil {
+		return err
+	}
+	return t.open()
+}
+
+// Sampled reports whether the next invocation should be recorded
+func (t *Tap) Sampled() bool {
+	return t != nil && t.sampleRate > 0 && (t.sampleRate >= 1 || rand.Float64() < t.sampleRate)
+}
+
+// Record writes an invocation of the function with msg. resp and body are nil when the
+// invocation failed with err.
+func (t *Tap) Record(source string, msg Message, resp *http.Response, body []byte, err error, latency time.Duration) error {
+	record := TapRecord{
+		Time:    time.Now().UTC(),
+		Source:  source,
+		Headers: t.redactor.Headers(msg.Headers()),
+		Latency: float64(latency.Microseconds()) / 1000,
+	}
+	if positioned, ok := msg.(PositionedMessage); ok {
+		record.Position = positioned.Position()
+	}
+	record.Payload, record.Truncated = t.body(msg.Body())
+	if resp != nil {
+		record.Response = &TapResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    t.redactor.Headers(resp.Header),
+		}
+		record.Response.Body, record.Response.Truncated = t.body(body)
+	}
+	if err != nil {
+		// Failed invocations carry the request already recorded and the function response
+		if details, ok := parseFunctionErrorDetails(err); ok {
+			resp := details.FunctionHTTPResponse
+			record.Response = &TapResponse{StatusCode: resp.StatusCode}
+			record.Response.Body, record.Response.Truncated = t.body([]byte(resp.ResponseBody))
+			record.Error = resp.ErrorString
+		} else {
+			record.Error = t.redactor.Body(err.Error())
+		}
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tap record: %w", err)
+	}
+	line = append(line, '\n')
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file != nil && t.size > 0 && t.size+int64(len(line)) > t.maxFileSize {
+		if err := t.rotate(); err != nil {
+			return fmt.Errorf("failed to rotate tap file: %w", err)
+		}
+	}
+	n, err := t.out.Write(line)
+	t.size += int64(n)
+	return err
+}
+
+// body redacts and truncates a payload or response body
+func (t *Tap) body(data []byte) (string, bool) {
+	return truncate(t.redactor.Body(string(data)), t.maxBodySize)
+}
+
+// Close closes the tap file
+func (t *Tap) Close() error {
+	if t == nil || t.file == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.file.Close()
+}
@@ -0,0 +1,259 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setTapEnv sets the TAP_* variables of a test, the others are cleared
+func setTapEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for _, key := range []string{"TAP_OUTPUT", "TAP_SAMPLE_RATE", "TAP_MAX_FILE_SIZE", "TAP_MAX_BODY_SIZE", "TAP_REDACT_HEADERS", "TAP_REDACT_BODY"} {
+		t.Setenv(key, env[key])
+	}
+}
+
+// readTapRecords returns the records of a tap file
+func readTapRecords(t *testing.T, path string) []TapRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []TapRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record TapRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestNewTapFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		nil  bool
+		err  bool
+	}{
+		{name: "disabled", nil: true},
+		{name: "stdout", env: map[string]string{"TAP_OUTPUT": "stdout", "TAP_SAMPLE_RATE": "0.5"}},
+		{name: "sample rate above 1", env: map[string]string{"TAP_OUTPUT": "stdout", "TAP_SAMPLE_RATE": "1.5"}, err: true},
+		{name: "invalid sample rate", env: map[string]string{"TAP_OUTPUT": "stdout", "TAP_SAMPLE_RATE": "half"}, err: true},
+		{name: "zero file size", env: map[string]string{"TAP_OUTPUT": "stdout", "TAP_MAX_FILE_SIZE": "0"}, err: true},
+		{name: "negative body size", env: map[string]string{"TAP_OUTPUT": "stdout", "TAP_MAX_BODY_SIZE": "-1"}, err: true},
+		{name: "invalid body pattern", env: map[string]string{"TAP_OUTPUT": "stdout", "TAP_REDACT_BODY": "("}, err: true},
+		{name: "missing directory", env: map[string]string{"TAP_OUTPUT": "/nonexistent/tap.jsonl"}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTapEnv(t, tt.env)
+			tap, err := NewTapFromEnv()
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (tap == nil) != tt.nil {
+				t.Errorf("tap %v, want nil %v", tap, tt.nil)
+			}
+		})
+	}
+}
+
+func TestTapRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tap.jsonl")
+	setTapEnv(t, map[string]string{
+		"TAP_OUTPUT":        path,
+		"TAP_MAX_BODY_SIZE": "16",
+		"TAP_REDACT_BODY":   `"password":"[^"]*"`,
+	})
+	tap, err := NewTapFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tap.Close()
+
+	msg := &testMessage{
+		body:     []byte(`{"password":"secret","id":1}`),
+		headers:  http.Header{"Authorization": {"Bearer token"}, "X-Id": {"1"}},
+		position: map[string]string{"partition": "0", "offset": "42"},
+	}
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Set-Cookie": {"session=1"}}}
+	if err := tap.Record("orders", msg, resp, []byte("accepted"), nil, 1500*time.Microsecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := tap.Record("orders", msg, nil, nil, errors.New("connection refused"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	records := readTapRecords(t, path)
+	if len(records) != 2 {
+		t.Fatalf("%d records, want 2", len(records))
+	}
+	record := records[0]
+	if record.Source != "orders" || record.Position["offset"] != "42" || record.Latency != 1.5 {
+		t.Errorf("record %+v", record)
+	}
+	if record.Payload != `{[REDACTED],"id"` || !record.Truncated {
+		t.Errorf("payload %q was not redacted and truncated", record.Payload)
+	}
+	if record.Headers.Get("Authorization") != redacted || record.Headers.Get("X-Id") != "1" {
+		t.Errorf("headers %v", record.Headers)
+	}
+	if record.Response == nil || record.Response.Body != "accepted" || record.Response.Headers.Get("Set-Cookie") != redacted {
+		t.Errorf("response %+v", record.Response)
+	}
+	if records[1].Response != nil || records[1].Error != "connection refused" {
+		t.Errorf("failed invocation recorded as %+v", records[1])
+	}
+}
+
+func TestTapRecordFunctionError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tap.jsonl")
+	setTapEnv(t, map[string]string{"TAP_OUTPUT": path})
+	tap, err := NewTapFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tap.Close()
+
+	details, _ := json.Marshal(FunctionErrorDetails{
+		FunctionHTTPRequest:  FunctionHTTPRequest{Message: "order"},
+		FunctionHTTPResponse: FunctionHTTPResponse{StatusCode: http.StatusBadGateway, ResponseBody: "upstream down", ErrorString: "bad gateway"},
+	})
+	if err := tap.Record("orders", &testMessage{body: []byte("order")}, nil, nil, errors.New(string(details)), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	record := readTapRecords(t, path)[0]
+	if record.Response == nil || record.Response.StatusCode != http.StatusBadGateway || record.Response.Body != "upstream down" || record.Error != "bad gateway" {
+		t.Errorf("function error recorded as %+v with response %+v", record, record.Response)
+	}
+}
+
+func TestTapRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tap.jsonl")
+	setTapEnv(t, map[string]string{"TAP_OUTPUT": path, "TAP_MAX_FILE_SIZE": "300"})
+	tap, err := NewTapFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tap.Close()
+
+	for range 4 {
+		if err := tap.Record("orders", &testMessage{body: []byte(strings.Repeat("x", 100))}, nil, nil, nil, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	current, rotated := readTapRecords(t, path), readTapRecords(t, path+".1")
+	if len(current) == 0 || len(rotated) == 0 || len(current)+len(rotated) > 4 {
+		t.Errorf("%d records in the file and %d in the rotated file", len(current), len(rotated))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 300 {
+		t.Errorf("tap file of %d bytes exceeds TAP_MAX_FILE_SIZE", info.Size())
+	}
+}
+
+func TestTapSampled(t *testing.T) {
+	var disabled *Tap
+	if disabled.Sampled() {
+		t.Error("nil tap sampled")
+	}
+	if (&Tap{sampleRate: 0}).Sampled() {
+		t.Error("tap with sample rate 0 sampled")
+	}
+	if !(&Tap{sampleRate: 1}).Sampled() {
+		t.Error("tap with sample rate 1 not sampled")
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  string
+		pattern  string
+		redacted []string
+		kept     []string
+		body     string
+	}{
+		{
+			name:     "defaults",
+			redacted: []string{"Authorization", "Cookie"},
+			kept:     []string{"X-Api-Key"},
+			body:     `{"token":"abc"}`,
+		},
+		{
+			name:     "configured headers",
+			headers:  "x-api-key, ",
+			pattern:  `"token":"[^"]*"`,
+			redacted: []string{"X-Api-Key"},
+			kept:     []string{"Authorization"},
+			body:     `{[REDACTED]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRedactor(tt.headers, tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			headers := r.Headers(http.Header{"Authorization": {"Bearer a"}, "Cookie": {"b"}, "X-Api-Key": {"c"}})
+			for _, key := range tt.redacted {
+				if headers.Get(key) != redacted {
+					t.Errorf("header %s not redacted", key)
+				}
+			}
+			for _, key := range tt.kept {
+				if headers.Get(key) == redacted {
+					t.Errorf("header %s redacted", key)
+				}
+			}
+			if body := r.Body(`{"token":"abc"}`); body != tt.body {
+				t.Errorf("body %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s         string
+		max       int
+		want      string
+		truncated bool
+	}{
+		{s: "short", max: 10, want: "short"},
+		{s: "exact", max: 5, want: "exact"},
+		{s: "too long", max: 3, want: "too", truncated: true},
+		{s: "héllo", max: 2, want: "h", truncated: true},
+		{s: "日本", max: 4, want: "日", truncated: true},
+		{s: "anything", max: 0, want: "", truncated: true},
+	}
+	for _, tt := range tests {
+		got, truncated := truncate(tt.s, tt.max)
+		if got != tt.want || truncated != tt.truncated {
+			t.Errorf("truncate(%q, %d) = %q, %v, want %q, %v", tt.s, tt.max, got, truncated, tt.want, tt.truncated)
+		}
+	}
+}
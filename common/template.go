@@ -0,0 +1,116 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// templatePlaceholder matches the placeholders of an endpoint template, e.g. {key} or {header.X-Tenant}
+var templatePlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// templateValues resolves the placeholders of endpoint templates for a message:
+//
+//   - {topic} is the topic the message was consumed from
+//   - {key} is the partitioning or ordering key of the message
+//   - {header.Name} is the value of a header of the message
+//   - {field.path} is the value of a field of the JSON payload, e.g. {field.order.id}
+//   - any other name is looked up in the position of the message, e.g. {partition} or {offset}
+type templateValues struct {
+	message []byte
+	headers http.Header
+	data    ConnectorMetadata
+
+	// payload is decoded on first use, it is left nil if it is not JSON
+	payload any
+	decoded bool
+}
+
+// validateEndpointTemplate checks the placeholders of endpoint are well-formed
+func validateEndpointTemplate(endpoint string) error {
+	for _, match := range templatePlaceholder.FindAllStringSubmatch(endpoint, -1) {
+		if name := match[1]; name == "" || name == "header." || name == "field." {
+			return fmt.Errorf("invalid placeholder %s in endpoint %s", match[0], endpoint)
+		}
+	}
+	return nil
+}
+
+// expand returns endpoint with its placeholders replaced by the values of the message.
+// Values are escaped for the part of the URL they appear in, a placeholder without a value
+// is an error.
+func (v *templateValues) expand(endpoint string) (string, error) {
+	if !strings.Contains(endpoint, "{") {
+		return endpoint, nil
+	}
+	query := strings.Index(endpoint, "?")
+
+	var (
+		b    strings.Builder
+		last int
+	)
+	for _, loc := range templatePlaceholder.FindAllStringSubmatchIndex(endpoint, -1) {
+		name := endpoint[loc[2]:loc[3]]
+		value, ok := v.lookup(name)
+		if !ok || value == "" {
+			return "", fmt.Errorf("no value for {%s} of endpoint %s", name, endpoint)
+		}
+		b.WriteString(endpoint[last:loc[0]])
+		if query >= 0 && loc[0] > query {
+			b.WriteString(url.QueryEscape(value))
+		} else {
+			b.WriteString(url.PathEscape(value))
+		}
+		last = loc[1]
+	}
+	b.WriteString(endpoint[last:])
+	return b.String(), nil
+}
+
+func (v *templateValues) lookup(name string) (string, bool) {
+	switch {
+	case name == "topic":
+		if topic := headerValue(v.headers, "KEDA-Topic"); topic != "" {
+			return topic, true
+		}
+		return v.data.Topic, true
+	case name == "key":
+		if v.data.message == nil {
+			return "", false
+		}
+		return v.data.message.Key(), true
+	case strings.HasPrefix(name, "header."):
+		value := headerValue(v.headers, strings.TrimPrefix(name, "header."))
+		return value, value != ""
+	case strings.HasPrefix(name, "field."):
+		if !v.decoded {
+			_ = json.Unmarshal(v.message, &v.payload)
+			v.decoded = true
+		}
+		return jsonField(v.payload, strings.TrimPrefix(name, "field."))
+	default:
+		positioned, ok := v.data.message.(PositionedMessage)
+		if !ok {
+			return "", false
+		}
+		value, ok := positioned.Position()[name]
+		return value, ok
+	}
+}
+
+// headerValue returns the first value of the header name, matched case-insensitively since
+// connector headers are not always canonical
+func headerValue(headers http.Header, name string) string {
+	if values := headers.Values(name); len(values) > 0 {
+		return values[0]
+	}
+	for key, values := range headers {
+		if strings.EqualFold(key, name) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
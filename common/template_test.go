@@ -0,0 +1,109 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTemplateExpand(t *testing.T) {
+	msg := &testMessage{
+		body:     []byte(`{"order": {"id": "a/b", "lines": [{"sku": "x y"}]}}`),
+		headers:  http.Header{"X-Tenant": {"acme"}, "KEDA-Topic": {"orders"}},
+		key:      "customer 1",
+		position: map[string]string{"partition": "3", "offset": "42"},
+	}
+	values := templateValues{
+		message: msg.body,
+		headers: msg.headers,
+		data:    ConnectorMetadata{Topic: "configured", message: msg},
+	}
+
+	tests := []struct {
+		endpoint string
+		want     string
+		err      bool
+	}{
+		{endpoint: "http://fn/orders", want: "http://fn/orders"},
+		{endpoint: "http://fn/{topic}", want: "http://fn/orders"},
+		{endpoint: "http://{header.x-tenant}.fn/", want: "http://acme.fn/"},
+		{endpoint: "http://fn/{key}", want: "http://fn/customer%201"},
+		{endpoint: "http://fn/?key={key}", want: "http://fn/?key=customer+1"},
+		{endpoint: "http://fn/{field.order.id}", want: "http://fn/a%2Fb"},
+		{endpoint: "http://fn/{field.order.lines.0.sku}", want: "http://fn/x%20y"},
+		{endpoint: "http://fn/{partition}/{offset}", want: "http://fn/3/42"},
+		{endpoint: "http://fn/{field.order.missing}", err: true},
+		{endpoint: "http://fn/{header.X-Missing}", err: true},
+		{endpoint: "http://fn/{epoch}", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			got, err := values.expand(tt.endpoint)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expanded to %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateTopicDefault(t *testing.T) {
+	values := templateValues{data: ConnectorMetadata{Topic: "configured"}}
+	if got, err := values.expand("http://fn/{topic}"); err != nil || got != "http://fn/configured" {
+		t.Errorf("expanded to %s with error %v, want http://fn/configured", got, err)
+	}
+}
+
+func TestValidateEndpointTemplate(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		err      bool
+	}{
+		{endpoint: "http://fn/{key}"},
+		{endpoint: "http://fn/{header.X-Tenant}"},
+		{endpoint: "http://fn/{}", err: true},
+		{endpoint: "http://fn/{header.}", err: true},
+		{endpoint: "http://fn/{field.}", err: true},
+	}
+	for _, tt := range tests {
+		if err := validateEndpointTemplate(tt.endpoint); (err != nil) != tt.err {
+			t.Errorf("validating %s returned %v", tt.endpoint, err)
+		}
+	}
+}
+
+func TestPipelineEndpointTemplate(t *testing.T) {
+	paths := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+	}))
+	defer srv.Close()
+
+	sink := &recordingSink{}
+	p := newTestPipeline(t, ConnectorMetadata{HTTPEndpoint: srv.URL + "/{header.X-Tenant}/{partition}", ErrorTopic: "errors"}, sink)
+
+	p.Handle(context.Background(), &testMessage{headers: http.Header{"X-Tenant": {"acme"}}, position: map[string]string{"partition": "3"}})
+	if path := <-paths; path != "/acme/3" {
+		t.Errorf("function invoked at %s, want /acme/3", path)
+	}
+
+	// A message without a value for a placeholder is not sent
+	p.Handle(context.Background(), &testMessage{position: map[string]string{"partition": "3"}})
+	select {
+	case path := <-paths:
+		t.Errorf("function invoked at %s without a tenant", path)
+	default:
+	}
+	if published := sink.published(); len(published) != 1 || published[0].Topic != "errors" {
+		t.Errorf("published %+v, want the error", published)
+	}
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -10,6 +11,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -26,12 +28,44 @@ type (
 		MaxRetries    int
 		ContentType   string
 		SourceName    string
+		// ResponseSink and ErrorSink are optional URLs of the brokers responses and errors
+		// are published to, by default the broker messages are consumed from is used
+		ResponseSink string
+		ErrorSink    string
+		// HTTPEndpoints are the endpoint sets of HTTP_ENDPOINT or HTTP_ENDPOINTS, every message is
+		// delivered to all of them according to DeliveryPolicy
+		HTTPEndpoints  []*EndpointSet
+		DeliveryPolicy string
+		// SecondaryTimeout bounds the background delivery to the secondary endpoints of the
+		// primary delivery policy
+		SecondaryTimeout time.Duration
+		// secondaries bounds the background deliveries of the primary delivery policy to
+		// SECONDARY_MAX_IN_FLIGHT, it is shared by the copies of the metadata
+		secondaries *secondaryDeliveries
+		// Routes optionally send messages to other endpoints and topics based on their content
+		Routes *RoutingTable
+		// ResponseTopicAllowlist holds the topic patterns the function can publish its response
+		// to with the KEDA-Response-Topic header
+		ResponseTopicAllowlist []string
+		// RPCMode publishes responses to the reply address of messages which have one
+		RPCMode bool
+		// HTTPMethod is the method of function invocations, POST by default
+		HTTPMethod string
+		// MaxResponseSize is the maximum size in bytes of function responses, 0 means unlimited
+		MaxResponseSize int64
+		// GRPCTimeout is the deadline of invocations of grpc:// endpoints
+		GRPCTimeout time.Duration
+
+		// message is the message being delivered, it provides the values of endpoint templates
+		message Message
 	}
 
 	FunctionHTTPRequest struct {
 		Message      string
 		HTTPEndpoint string
 		Headers      http.Header
+		// Truncated is set when Message was cut to fit the error envelope in the error sink
+		Truncated bool `json:",omitempty"`
 	}
 
 	FunctionHTTPResponse struct {
@@ -43,12 +77,20 @@ type (
 	FunctionErrorDetails struct {
 		FunctionHTTPRequest  FunctionHTTPRequest
 		FunctionHTTPResponse FunctionHTTPResponse
+		// Endpoints holds the result of every endpoint when the message was fanned out
+		Endpoints []FunctionEndpointResult `json:",omitempty"`
 	}
 )
 
 // ParseConnectorMetadata parses connector side common fields and returns as ConnectorMetadata or returns error
 func ParseConnectorMetadata() (ConnectorMetadata, error) {
-	for _, envVars := range []string{"TOPIC", "HTTP_ENDPOINT", "MAX_RETRIES", "CONTENT_TYPE"} {
+	return parseConnectorMetadata("TOPIC", "MAX_RETRIES", "CONTENT_TYPE")
+}
+
+// parseConnectorMetadata parses the connector metadata, the required environment variables must
+// be set and the others keep their defaults. An endpoint is always required.
+func parseConnectorMetadata(required ...string) (ConnectorMetadata, error) {
+	for _, envVars := range required {
 		if os.Getenv(envVars) == "" {
 			return ConnectorMetadata{}, fmt.Errorf("environment variable not found: %v", envVars)
 		}
@@ -57,47 +99,196 @@ func ParseConnectorMetadata() (ConnectorMetadata, error) {
 		Topic:         os.Getenv("TOPIC"),
 		ResponseTopic: os.Getenv("RESPONSE_TOPIC"),
 		ErrorTopic:    os.Getenv("ERROR_TOPIC"),
-		HTTPEndpoint:  os.Getenv("HTTP_ENDPOINT"),
 		ContentType:   os.Getenv("CONTENT_TYPE"),
 		SourceName:    os.Getenv("SOURCE_NAME"),
+		ResponseSink:  os.Getenv("RESPONSE_SINK"),
+		ErrorSink:     os.Getenv("ERROR_SINK"),
 	}
 	if meta.SourceName == "" {
 		meta.SourceName = "KEDAConnector"
 	}
-	val, err := strconv.ParseInt(strings.TrimSpace(os.Getenv("MAX_RETRIES")), 0, 64)
+	method, err := parseHTTPMethod(os.Getenv("HTTP_METHOD"))
+	if err != nil {
+		return ConnectorMetadata{}, err
+	}
+	meta.HTTPMethod = method
+	meta.HTTPEndpoint, meta.HTTPEndpoints, err = parseEndpointsEnv()
+	if err != nil {
+		return ConnectorMetadata{}, err
+	}
+	policy, err := parseDeliveryPolicy(os.Getenv("DELIVERY_POLICY"))
+	if err != nil {
+		return ConnectorMetadata{}, err
+	}
+	meta.DeliveryPolicy = policy
+	meta.SecondaryTimeout, err = parseSecondaryTimeout()
+	if err != nil {
+		return ConnectorMetadata{}, err
+	}
+	secondaryMaxInFlight, err := parseSecondaryMaxInFlight()
+	if err != nil {
+		return ConnectorMetadata{}, err
+	}
+	meta.secondaries = newSecondaryDeliveries(secondaryMaxInFlight)
+	meta.Routes, err = parseRoutingTable()
+	if err != nil {
+		return ConnectorMetadata{}, err
+	}
+	meta.MaxResponseSize, err = parseMaxResponseSize()
+	if err != nil {
+		return ConnectorMetadata{}, err
+	}
+	meta.GRPCTimeout, err = parseGRPCTimeout()
 	if err != nil {
-		return ConnectorMetadata{}, fmt.Errorf("failed to parse value from MAX_RETRIES environment variable %v", err)
+		return ConnectorMetadata{}, err
+	}
+	meta.ResponseTopicAllowlist, err = parseTopicAllowlist(os.Getenv("RESPONSE_TOPIC_ALLOWLIST"))
+	if err != nil {
+		return ConnectorMetadata{}, err
+	}
+	if v := os.Getenv("RPC_MODE"); v != "" {
+		meta.RPCMode, err = strconv.ParseBool(v)
+		if err != nil {
+			return ConnectorMetadata{}, fmt.Errorf("failed to parse value from RPC_MODE environment variable %v", err)
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("MAX_RETRIES")); v != "" {
+		val, err := strconv.ParseInt(v, 0, 64)
+		if err != nil {
+			return ConnectorMetadata{}, fmt.Errorf("failed to parse value from MAX_RETRIES environment variable %v", err)
+		}
+		meta.MaxRetries = int(val)
 	}
-	meta.MaxRetries = int(val)
 	return meta, nil
 }
 
-// HandleHTTPRequest sends message and headers data to HTTP endpoint using POST method and returns response on success or error in case of failure
+// KEDAHeaders returns the KEDA-* headers most connectors send to the function with every message
+func KEDAHeaders(connectordata ConnectorMetadata) http.Header {
+	return http.Header{
+		"KEDA-Topic":          {connectordata.Topic},
+		"KEDA-Response-Topic": {connectordata.ResponseTopic},
+		"KEDA-Error-Topic":    {connectordata.ErrorTopic},
+		"Content-Type":        {connectordata.ContentType},
+		"KEDA-Source-Name":    {connectordata.SourceName},
+	}
+}
+
+// HandleHTTPRequest sends message and headers data to HTTP endpoint using HTTPMethod and returns response on success or error in case of failure.
+// When several endpoints are configured the message is sent to all of them, see fanOut.
 func HandleHTTPRequest(message string, headers http.Header, data ConnectorMetadata, logger *zap.Logger) (*http.Response, error) {
+	return InvokeFunction(context.Background(), []byte(message), headers, data, logger)
+}
+
+// InvokeFunction is HandleHTTPRequest for a payload held as bytes. Every endpoint and attempt
+// streams the request body from payload, which is never copied, and the invocations are
+// cancelled with ctx.
+func InvokeFunction(ctx context.Context, payload []byte, headers http.Header, data ConnectorMetadata, logger *zap.Logger) (*http.Response, error) {
+	IncMetric(MetricFunctionInvocations)
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	if endpoints := data.endpoints(); len(endpoints) > 1 {
+		resp, err = fanOut(ctx, payload, headers, endpoints, data, logger)
+	} else {
+		resp, err = invokeEndpoint(ctx, payload, headers, endpoints[0], data, logger)
+	}
+	if err != nil {
+		IncMetric(MetricFunctionInvocationFailures)
+	}
+	return resp, err
+}
+
+// parseHTTPMethod validates the method of HTTP_METHOD, it defaults to POST
+func parseHTTPMethod(method string) (string, error) {
+	switch method = strings.ToUpper(method); method {
+	case "":
+		return http.MethodPost, nil
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return method, nil
+	default:
+		return "", fmt.Errorf("invalid HTTP_METHOD %q, must be one of POST, PUT, PATCH or DELETE", method)
+	}
+}
+
+// endpoints returns the endpoint sets messages are sent to
+func (data ConnectorMetadata) endpoints() []*EndpointSet {
+	if len(data.HTTPEndpoints) == 0 {
+		return []*EndpointSet{singleEndpointSet(data.HTTPEndpoint)}
+	}
+	return data.HTTPEndpoints
+}
+
+// invokeEndpoint sends message to a member of the endpoint set, retrying up to MaxRetries times
+// or until ctx is done
+func invokeEndpoint(ctx context.Context, message []byte, headers http.Header, endpoints *EndpointSet, data ConnectorMetadata, logger *zap.Logger) (*http.Response, error) {
+	data.HTTPEndpoint = endpoints.String()
+	method := data.HTTPMethod
+	if method == "" {
+		method = http.MethodPost
+	}
+	values := &templateValues{message: message, headers: headers, data: data}
 
 	var resp *http.Response
 	for attempt := 0; attempt <= data.MaxRetries; attempt++ {
-		// Create request
-		req, err := http.NewRequest("POST", data.HTTPEndpoint, strings.NewReader(message))
-		if err != nil {
-			return nil, fmt.Errorf("failed to create HTTP request to invoke function. http_endpoint: %s, source: %s: %w", data.HTTPEndpoint, data.SourceName, err)
+		if ctx.Err() != nil {
+			break
 		}
-
-		// Add headers
-		for key, vals := range headers {
-			for _, val := range vals {
-				req.Header.Add(key, val)
+		if attempt > 0 {
+			IncMetric(MetricFunctionInvocationRetries)
+			// The response of the failed attempt is replaced by the one of this attempt
+			if resp != nil {
+				if err := resp.Body.Close(); err != nil {
+					logger.Error("failed to close response body", zap.Error(err), zap.String("http_endpoint", data.HTTPEndpoint))
+				}
+				resp = nil
 			}
 		}
 
-		// Make the request
-		resp, err = http.DefaultClient.Do(req)
-		if err != nil {
-			logger.Error("sending function invocation request failed",
-				zap.Error(err),
-				zap.String("http_endpoint", data.HTTPEndpoint),
-				zap.String("source", data.SourceName))
-			continue
+		// Fail over to the next member of the set on connection errors
+		for _, endpoint := range endpoints.order() {
+			target, err := values.expand(endpoint)
+			if err != nil {
+				return nil, fmt.Errorf("failed to invoke function, source: %s: %w", data.SourceName, err)
+			}
+			if isGRPCEndpoint(target) {
+				resp, err = invokeGRPC(ctx, target, message, headers, data.GRPCTimeout)
+			} else {
+				// Create request, the body and GetBody read message without copying it
+				req, reqErr := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(message))
+				if reqErr != nil {
+					return nil, fmt.Errorf("failed to create HTTP request to invoke function. http_endpoint: %s, source: %s: %w", target, data.SourceName, reqErr)
+				}
+
+				// Add headers
+				for key, vals := range headers {
+					for _, val := range vals {
+						req.Header.Add(key, val)
+					}
+				}
+
+				// Make the request
+				resp, err = http.DefaultClient.Do(req)
+			}
+			if err != nil && ctx.Err() != nil {
+				// The invocation was cancelled, which says nothing about the endpoint
+				return nil, fmt.Errorf("failed to invoke function. http_endpoint: %s, source: %s: %w", target, data.SourceName, ctx.Err())
+			}
+			if err != nil {
+				logger.Error("sending function invocation request failed",
+					zap.Error(err),
+					zap.String("http_endpoint", target),
+					zap.String("source", data.SourceName))
+				if endpoints.failed(endpoint) {
+					logger.Warn("ejecting endpoint after repeated connection errors",
+						zap.String("http_endpoint", endpoint),
+						zap.Duration("duration", endpoints.ejectDuration))
+				}
+				continue
+			}
+			endpoints.succeeded(endpoint)
+			break
 		}
 		if resp == nil {
 			continue
@@ -108,9 +299,15 @@ func HandleHTTPRequest(message string, headers http.Header, data ConnectorMetada
 		}
 	}
 
-	if resp == nil || resp.StatusCode < 200 || resp.StatusCode > 300 {
-		errResp := NewFunctionErrorDetails(message, data.HTTPEndpoint, headers)
+	if resp == nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		errResp := NewFunctionErrorDetails(string(message), data.HTTPEndpoint, headers)
 		err := errResp.UpdateResponseDetails(resp, data)
+		if resp != nil {
+			// The body was read into the error details
+			if closeErr := resp.Body.Close(); closeErr != nil {
+				logger.Error("failed to close response body", zap.Error(closeErr), zap.String("http_endpoint", data.HTTPEndpoint))
+			}
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -165,8 +362,13 @@ func (errResp *FunctionErrorDetails) UpdateResponseDetails(resp *http.Response,
 		return errors.New(string(errorBytes))
 	}
 
-	if resp.StatusCode < 200 || resp.StatusCode > 300 {
-		body, err := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// The body of the error response is truncated to MaxResponseSize
+		respBody := io.Reader(resp.Body)
+		if data.MaxResponseSize > 0 {
+			respBody = io.LimitReader(resp.Body, data.MaxResponseSize)
+		}
+		body, err := io.ReadAll(respBody)
 		if err != nil {
 			return fmt.Errorf("failed reading response body. http_endpoint: %s, source: %s", data.HTTPEndpoint, data.SourceName)
 		}
@@ -0,0 +1,188 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"cloud.google.com/go/pubsub/v2"
+	"go.uber.org/zap"
+	"google.golang.org/api/option"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+type pubsubConnector struct {
+	pubsubInfo    GCPPubsubConnInfo
+	client        *pubsub.Client
+	connectordata common.ConnectorMetadata
+	logger        *zap.Logger
+
+	common.PauseGate
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// GCPPubsubConnInfo contains the fields needed to connect to the GCP's pub sub topic queue.
+type GCPPubsubConnInfo struct {
+	ProjectID      string
+	SubscriptionID string
+	// Creds points to the json value(not file) which has the service account key
+	Creds string
+}
+
+// Command runs the GCP Pub/Sub connector
+var Command = common.Command{
+	Name:        "gcp-pubsub",
+	Description: "Receive messages from a GCP Pub/Sub subscription and post them to an HTTP endpoint",
+	Run:         Run,
+	Headers:     common.KEDAHeaders,
+}
+
+// Run receives messages from the configured subscription until ctx is cancelled
+func Run(ctx context.Context, logger *zap.Logger, connectordata common.ConnectorMetadata) error {
+	pubsubInfo, err := GetGCPInfo()
+	if err != nil {
+		return fmt.Errorf("failed to find GCP creds or project name or subscription name: %w", err)
+	}
+	client, err := pubsub.NewClient(ctx, pubsubInfo.ProjectID, option.WithAuthCredentialsJSON(option.ServiceAccount, []byte(pubsubInfo.Creds)))
+	if err != nil {
+		return fmt.Errorf("failed to create pubsub client: %w", err)
+	}
+	defer client.Close()
+
+	sink := newPubsubSink(client)
+	defer sink.Close()
+
+	pipeline, err := common.NewPipeline(ctx, logger, connectordata, sink)
+	if err != nil {
+		return err
+	}
+	defer pipeline.Close()
+
+	conn := &pubsubConnector{
+		pubsubInfo:    *pubsubInfo,
+		client:        client,
+		connectordata: connectordata,
+		logger:        logger,
+	}
+
+	logger.Info("Conn: %s", zap.String("Response topic", conn.connectordata.ResponseTopic))
+	common.RegisterPausable(conn)
+	err = conn.Consume(ctx, pipeline.Handle)
+	if err != nil {
+		return fmt.Errorf("error in consuming message from pubsub: %w", err)
+	}
+	return nil
+}
+
+// pubsubMessage is a message received from the subscription
+type pubsubMessage struct {
+	msg     *pubsub.Message
+	headers http.Header
+}
+
+func (m *pubsubMessage) Body() []byte         { return m.msg.Data }
+func (m *pubsubMessage) Headers() http.Header { return m.headers }
+func (m *pubsubMessage) Key() string          { return m.msg.OrderingKey }
+
+// Position returns the id of the message
+func (m *pubsubMessage) Position() map[string]string {
+	return map[string]string{"messageId": m.msg.ID}
+}
+
+// Ack acknowledges the message
+func (m *pubsubMessage) Ack() error {
+	m.msg.Ack()
+	return nil
+}
+
+// Nack leaves the message unacknowledged, it is redelivered once its ack deadline is no longer extended
+func (m *pubsubMessage) Nack() error {
+	return nil
+}
+
+// Consume receives messages from the subscription until ctx is cancelled
+func (conn *pubsubConnector) Consume(ctx context.Context, handler common.MessageHandler) error {
+	headers := common.KEDAHeaders(conn.connectordata)
+
+	var mu sync.Mutex
+	sub := conn.client.Subscriber(conn.pubsubInfo.SubscriptionID)
+
+	for {
+		if err := conn.Wait(ctx); err != nil {
+			return nil
+		}
+
+		// Receive runs until ctx is cancelled or the connector is paused
+		receiveCtx, cancel := context.WithCancel(ctx)
+		conn.mu.Lock()
+		conn.cancel = cancel
+		conn.mu.Unlock()
+
+		err := sub.Receive(receiveCtx, func(_ context.Context, msg *pubsub.Message) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			// Set the attributes as message header came from PubSub record
+			msgHeaders := headers.Clone()
+			for k, v := range msg.Attributes {
+				msgHeaders.Add(k, v)
+			}
+
+			handler(ctx, &pubsubMessage{msg: msg, headers: msgHeaders})
+		})
+		cancel()
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// Pause stops receiving, Receive returns once the messages being handled are done
+func (conn *pubsubConnector) Pause() error {
+	if err := conn.PauseGate.Pause(); err != nil {
+		return err
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.cancel != nil {
+		conn.cancel()
+	}
+	return nil
+}
+
+// GetGCPInfo gets the configuration required to connect to GCP
+func GetGCPInfo() (*GCPPubsubConnInfo, error) {
+
+	creds := os.Getenv("CREDENTIALS_FROM_ENV")
+	projectID := os.Getenv("PROJECT_ID")
+	subscriptionID := os.Getenv("SUBSCRIPTION_NAME")
+	triggerCreds := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+
+	if projectID != "" && subscriptionID != "" && triggerCreds != "" {
+		connInfo := &GCPPubsubConnInfo{
+			ProjectID:      projectID,
+			SubscriptionID: subscriptionID,
+			Creds:          triggerCreds,
+		}
+		return connInfo, nil
+	}
+	if subscriptionID != "" && creds != "" {
+		connInfo := &GCPPubsubConnInfo{
+			ProjectID:      projectID,
+			SubscriptionID: subscriptionID,
+			Creds:          creds,
+		}
+		return connInfo, nil
+	}
+
+	return nil, errors.New("provide credentials")
+
+}
@@ -0,0 +1,120 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"cloud.google.com/go/pubsub/v2"
+	"go.uber.org/zap"
+	"google.golang.org/api/option"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+func init() {
+	common.RegisterSink("gcppubsub", newPubsubSinkFromURL)
+}
+
+// pubsubSink publishes messages to the topic named by the message topic
+type pubsubSink struct {
+	client *pubsub.Client
+	// owned is set when the sink created the client and has to close it
+	owned bool
+
+	mu         sync.Mutex
+	publishers map[string]*pubsub.Publisher
+}
+
+func newPubsubSink(client *pubsub.Client) *pubsubSink {
+	return &pubsubSink{client: client, publishers: map[string]*pubsub.Publisher{}}
+}
+
+// newPubsubSinkFromURL creates a sink from a URL of the form gcppubsub://<project_id>. The service
+// account key is read from CREDENTIALS_FROM_ENV or GOOGLE_APPLICATION_CREDENTIALS, application
+// default credentials are used when neither is set.
+func newPubsubSinkFromURL(ctx context.Context, u *url.URL, _ common.ConnectorMetadata, _ *zap.Logger) (common.Sink, error) {
+	if u.Host == "" {
+		return nil, errors.New("no project id given in pubsub sink url")
+	}
+
+	var options []option.ClientOption
+	for _, env := range []string{"CREDENTIALS_FROM_ENV", "GOOGLE_APPLICATION_CREDENTIALS"} {
+		if creds := os.Getenv(env); creds != "" {
+			options = append(options, option.WithAuthCredentialsJSON(option.ServiceAccount, []byte(creds)))
+			break
+		}
+	}
+	client, err := pubsub.NewClient(ctx, u.Host, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pubsub client: %w", err)
+	}
+	sink := newPubsubSink(client)
+	sink.owned = true
+	return sink, nil
+}
+
+func (s *pubsubSink) publisher(topicID string) *pubsub.Publisher {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.publishers[topicID]
+	if !ok {
+		p = s.client.Publisher(topicID)
+		s.publishers[topicID] = p
+	}
+	return p
+}
+
+func (s *pubsubSink) Publish(ctx context.Context, msg common.SinkMessage) error {
+	result := s.publisher(msg.Topic).Publish(ctx, &pubsub.Message{
+		Data:       msg.Body,
+		Attributes: convHeadersToAttr(msg.Headers),
+	})
+	// The Get method blocks until a server-generated ID or
+	// an error is returned for the published message.
+	_, err := result.Get(ctx)
+	return err
+}
+
+// MaxMessageSize returns the 10 MB limit of Pub/Sub for the data and attributes of a message
+func (s *pubsubSink) MaxMessageSize() int {
+	return 10 * 1000 * 1000
+}
+
+// Size counts the data and attributes of the message, the key is not sent to Pub/Sub
+func (s *pubsubSink) Size(msg common.SinkMessage) int {
+	size := len(msg.Body)
+	for key, value := range convHeadersToAttr(msg.Headers) {
+		size += len(key) + len(value)
+	}
+	return size
+}
+
+func (s *pubsubSink) Close() error {
+	s.mu.Lock()
+	for _, p := range s.publishers {
+		p.Stop()
+	}
+	s.publishers = map[string]*pubsub.Publisher{}
+	s.mu.Unlock()
+
+	if !s.owned {
+		return nil
+	}
+	return s.client.Close()
+}
+
+// convHeadersToAttr converts the headers to attributes which can be published by pubsub
+func convHeadersToAttr(headers http.Header) map[string]string {
+	var attr = make(map[string]string)
+	for k, v := range headers {
+		for _, d := range v {
+			attr[k] = d
+		}
+	}
+	return attr
+}
@@ -0,0 +1,150 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+// Failure policies selected by ON_FAILURE, they decide what happens to the offset of a
+// record which could not be processed
+const (
+	// onFailureSkip commits the offset once the error has been published to the error topic
+	onFailureSkip = "skip"
+	// onFailureRetryForever processes the record again with a backoff, blocking its partition
+	onFailureRetryForever = "retry-forever"
+	// onFailureStop pauses the partition and reports the connector as unhealthy
+	onFailureStop = "stop"
+)
+
+const (
+	defaultRetryBackoff        = time.Second
+	defaultRetryMaxBackoff     = time.Minute
+	defaultErrorPublishRetries = 3
+)
+
+// failurePolicy is the handling of records which could not be processed
+type failurePolicy struct {
+	onFailure      string
+	backoff        time.Duration
+	maxBackoff     time.Duration
+	publishRetries int
+}
+
+// parseFailurePolicy reads the failure policy from the environment
+func parseFailurePolicy() (failurePolicy, error) {
+	policy := failurePolicy{
+		onFailure:      os.Getenv("ON_FAILURE"),
+		backoff:        defaultRetryBackoff,
+		maxBackoff:     defaultRetryMaxBackoff,
+		publishRetries: defaultErrorPublishRetries,
+	}
+	switch policy.onFailure {
+	case "":
+		policy.onFailure = onFailureSkip
+	case onFailureSkip, onFailureRetryForever, onFailureStop:
+	default:
+		return policy, fmt.Errorf("invalid ON_FAILURE %q, must be one of %s, %s or %s", policy.onFailure, onFailureSkip, onFailureRetryForever, onFailureStop)
+	}
+
+	backoff, err := envDuration("RETRY_BACKOFF")
+	if err != nil {
+		return policy, err
+	}
+	if backoff > 0 {
+		policy.backoff = backoff
+	}
+	maxBackoff, err := envDuration("RETRY_MAX_BACKOFF")
+	if err != nil {
+		return policy, err
+	}
+	if maxBackoff > 0 {
+		policy.maxBackoff = maxBackoff
+	}
+	if policy.maxBackoff < policy.backoff {
+		return policy, fmt.Errorf("RETRY_MAX_BACKOFF %v must not be lower than RETRY_BACKOFF %v", policy.maxBackoff, policy.backoff)
+	}
+	if v := os.Getenv("ERROR_PUBLISH_RETRIES"); v != "" {
+		policy.publishRetries, err = strconv.Atoi(v)
+		if err != nil || policy.publishRetries < 0 {
+			return policy, fmt.Errorf("ERROR_PUBLISH_RETRIES must be a number of retries, got %q", v)
+		}
+	}
+	return policy, nil
+}
+
+// topicPartition identifies a partition of a topic
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// stop pauses the partition of message and reports the connector as unhealthy. The partition
+// stays paused while it is claimed by the connector.
+func (conn *kafkaConnector) stop(message *sarama.ConsumerMessage) {
+	reason := fmt.Sprintf("partition %d of topic %s stopped at offset %d after a failed record", message.Partition, message.Topic, message.Offset)
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	tp := topicPartition{message.Topic, message.Partition}
+	if _, ok := conn.stopped[tp]; ok {
+		// Another worker of the partition stopped it first
+		return
+	}
+	if conn.stopped == nil {
+		conn.stopped = map[topicPartition]string{}
+	}
+	conn.stopped[tp] = reason
+	conn.client.Pause(map[string][]int32{tp.topic: {tp.partition}})
+	common.ReportUnhealthy(reason)
+	conn.logger.Error("stopped consuming partition after a failed record",
+		zap.String("topic", message.Topic),
+		zap.Int32("partition", message.Partition),
+		zap.Int64("offset", message.Offset))
+}
+
+// process handles message until it is acknowledged. A record which is not acknowledged, either
+// because the function failed or because its error could not be published, is processed again
+// or stops the partition according to the failure policy. process returns false when the
+// partition has been stopped.
+func (conn *kafkaConnector) process(ctx context.Context, session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage, tracker *offsetTracker) bool {
+	if !conn.waitUntilDue(ctx, message) {
+		return false
+	}
+	backoff := conn.metadata.failure.backoff
+	for attempt := 1; ; attempt++ {
+		if conn.handle(ctx, session, message, tracker, nil) {
+			return true
+		}
+
+		if conn.metadata.failure.onFailure == onFailureStop {
+			conn.stop(message)
+			// The claim is kept until the session ends, so that the records fetched after
+			// the failed one are not processed
+			<-ctx.Done()
+			return false
+		}
+
+		conn.logger.Warn("record not processed, retrying",
+			zap.String("topic", message.Topic),
+			zap.Int32("partition", message.Partition),
+			zap.Int64("offset", message.Offset),
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff))
+		select {
+		case <-ctx.Done():
+			// The partition was revoked, its offset is not committed so the record is
+			// consumed again by the next owner of the partition
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, conn.metadata.failure.maxBackoff)
+	}
+}
@@ -0,0 +1,205 @@
+package connector
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+// flakyFunction starts a function failing its first failures invocations, it returns the
+// endpoint and the number of invocations
+func flakyFunction(t *testing.T, failures int32) (string, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = io.WriteString(w, "response")
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &calls
+}
+
+// publishingSink records the published messages, publishing to failTopic fails
+type publishingSink struct {
+	mu        sync.Mutex
+	failTopic string
+	msgs      []common.SinkMessage
+}
+
+func (s *publishingSink) Publish(_ context.Context, msg common.SinkMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if msg.Topic == s.failTopic {
+		return errTestCommit
+	}
+	s.msgs = append(s.msgs, msg)
+	return nil
+}
+
+// topics returns the topics of the published messages
+func (s *publishingSink) topics() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var topics []string
+	for _, msg := range s.msgs {
+		topics = append(topics, msg.Topic)
+	}
+	return topics
+}
+
+func (s *publishingSink) Close() error { return nil }
+
+// pausingGroup records the partitions paused on a consumer group
+type pausingGroup struct {
+	sarama.ConsumerGroup
+	paused map[string][]int32
+}
+
+func (g *pausingGroup) Pause(partitions map[string][]int32) {
+	if g.paused == nil {
+		g.paused = map[string][]int32{}
+	}
+	for topic, ids := range partitions {
+		g.paused[topic] = append(g.paused[topic], ids...)
+	}
+}
+
+func TestProcessRetryForever(t *testing.T) {
+	endpoint, calls := flakyFunction(t, 2)
+	sink := &publishingSink{}
+	conn, pipeline := newTestConnector(t, endpoint, sink)
+	pipeline.SkipErrorPublish = true
+	conn.metadata.failure = failurePolicy{onFailure: onFailureRetryForever, backoff: time.Millisecond, maxBackoff: time.Millisecond}
+	session := &markingSession{}
+
+	record := &sarama.ConsumerMessage{Topic: "orders", Offset: 7, Value: []byte("order")}
+	if !conn.process(context.Background(), session, record, nil) {
+		t.Fatal("record not processed")
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("function invoked %d times, want 3", n)
+	}
+	if !slices.Equal(session.marked, []int64{8}) {
+		t.Errorf("marked offsets %v, want 8 once", session.marked)
+	}
+	// Only the response is published, the errors of the failed attempts are logged
+	if !slices.Equal(sink.topics(), []string{"responses"}) {
+		t.Errorf("published to %v", sink.topics())
+	}
+}
+
+func TestProcessRevoked(t *testing.T) {
+	endpoint, _ := flakyFunction(t, 1000)
+	conn, pipeline := newTestConnector(t, endpoint, &publishingSink{})
+	pipeline.SkipErrorPublish = true
+	conn.metadata.failure = failurePolicy{onFailure: onFailureRetryForever, backoff: time.Hour, maxBackoff: time.Hour}
+	session := &markingSession{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if conn.process(ctx, session, &sarama.ConsumerMessage{Topic: "orders", Offset: 7}, nil) {
+		t.Error("failed record processed")
+	}
+	if len(session.marked) > 0 {
+		t.Errorf("offsets %v of a revoked partition marked", session.marked)
+	}
+}
+
+func TestProcessSkip(t *testing.T) {
+	tests := []struct {
+		name      string
+		failTopic string
+		// calls is the number of invocations once the record has been processed
+		calls int32
+	}{
+		{name: "error published", calls: 1},
+		// The record is processed again until its error has been published
+		{name: "error not published", failTopic: "errors"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint, calls := flakyFunction(t, 1000)
+			sink := &publishingSink{failTopic: tt.failTopic}
+			conn, pipeline := newTestConnector(t, endpoint, sink)
+			pipeline.AckAfterError = true
+			conn.metadata.failure = failurePolicy{onFailure: onFailureSkip, backoff: time.Millisecond, maxBackoff: time.Millisecond}
+			session := &markingSession{}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			processed := conn.process(ctx, session, &sarama.ConsumerMessage{Topic: "orders", Offset: 7}, nil)
+			if tt.failTopic != "" {
+				if processed || len(session.marked) > 0 || calls.Load() < 2 {
+					t.Errorf("processed %v, marked %v after %d invocations", processed, session.marked, calls.Load())
+				}
+				return
+			}
+			if !processed || calls.Load() != tt.calls || !slices.Equal(session.marked, []int64{8}) {
+				t.Errorf("processed %v, marked %v after %d invocations", processed, session.marked, calls.Load())
+			}
+			if !slices.Equal(sink.topics(), []string{"errors"}) {
+				t.Errorf("published to %v", sink.topics())
+			}
+		})
+	}
+}
+
+func TestProcessStop(t *testing.T) {
+	endpoint, calls := flakyFunction(t, 1000)
+	conn, _ := newTestConnector(t, endpoint, &publishingSink{})
+	group := &pausingGroup{}
+	conn.client = group
+	conn.metadata.failure = failurePolicy{onFailure: onFailureStop}
+	session := &markingSession{}
+	record := &sarama.ConsumerMessage{Topic: "orders", Partition: 3, Offset: 7}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() { done <- conn.process(ctx, session, record, nil) }()
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn.mu.Lock()
+		_, stopped := conn.stopped[topicPartition{"orders", 3}]
+		conn.mu.Unlock()
+		if stopped || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// The claim is held until the session ends
+	cancel()
+	if <-done {
+		t.Error("failed record processed")
+	}
+	reason, stopped := conn.stopped[topicPartition{"orders", 3}]
+	if !stopped {
+		t.Fatal("partition not stopped")
+	}
+	t.Cleanup(func() { common.ClearUnhealthy(reason) })
+	if !slices.Equal(group.paused["orders"], []int32{3}) {
+		t.Errorf("paused partitions %v", group.paused)
+	}
+	if n := calls.Load(); n != 1 || len(session.marked) > 0 {
+		t.Errorf("function invoked %d times, marked offsets %v", n, session.marked)
+	}
+
+	// A second failure of the partition keeps the first reason
+	conn.stop(&sarama.ConsumerMessage{Topic: "orders", Partition: 3, Offset: 8})
+	if conn.stopped[topicPartition{"orders", 3}] != reason {
+		t.Error("reason of the stopped partition replaced")
+	}
+}
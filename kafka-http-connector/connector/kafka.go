@@ -0,0 +1,802 @@
+package connector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+// Following code snippet is from KEDA project and adapted for Fission.
+// Copyright 2020 The KEDA Authors.
+// and others that have contributed code to the public domain.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// https://github.com/kedacore/keda/blob/v1.5.0/LICENSE
+
+// https://github.com/kedacore/keda/blob/v1.5.0/pkg/scalers/kafka_scaler.go#L28
+type kafkaMetadata struct {
+	bootstrapServers  []string
+	consumerGroup     string
+	offsetResetPolicy string
+
+	// topics are the topics consumed, or topicPattern matches them when TOPIC is a regex
+	topics               []string
+	topicPattern         *regexp.Regexp
+	topicRefreshInterval time.Duration
+
+	// partitionWorkers is the number of records of a partition processed concurrently
+	partitionWorkers int
+
+	tuning consumerTuning
+	// producer holds the settings of the producer of the response and error topics
+	producer producerTuning
+
+	// exactlyOnce processes every record in a transaction committing its offset together
+	// with the response or error records
+	exactlyOnce           bool
+	transactionalIDPrefix string
+
+	failure failurePolicy
+
+	// retryDelays are the delays of the retry topics failed records are produced to
+	retryDelays []time.Duration
+
+	// SASL
+	saslType      string
+	username      string
+	password      string
+	tokenProvider sarama.AccessTokenProvider
+
+	// TLS
+	tls  string
+	cert string
+	key  string
+	ca   string
+}
+
+// topicRegexPrefix marks a TOPIC which is a regular expression matching the topics to consume
+const topicRegexPrefix = "regex:"
+
+const defaultTopicRefreshInterval = time.Minute
+
+const (
+	kafkaAuthModeNone            string = ""
+	kafkaAuthModeSaslPlaintext   string = "plaintext"
+	kafkaAuthModeSaslScramSha256 string = "scram_sha256"
+	kafkaAuthModeSaslScramSha512 string = "scram_sha512"
+	kafkaAuthModeSaslOAuthBearer string = "oauthbearer"
+	kafkaAuthModeSaslAWSMSKIAM   string = "aws_msk_iam"
+)
+
+// https://github.com/kedacore/keda/blob/v1.5.0/pkg/scalers/kafka_scaler.go#L83
+func parseKafkaMetadata(logger *zap.Logger) (kafkaMetadata, error) {
+	meta := kafkaMetadata{}
+
+	// brokerList marked as deprecated, bootstrapServers is the new one to use
+	if os.Getenv("BROKER_LIST") != "" && os.Getenv("BOOTSTRAP_SERVERS") != "" {
+		return meta, errors.New("cannot specify both bootstrapServers and brokerList (deprecated)")
+	}
+	if os.Getenv("BROKER_LIST") == "" && os.Getenv("BOOTSTRAP_SERVERS") == "" {
+		return meta, errors.New("no bootstrapServers or brokerList (deprecated) given")
+	}
+	if os.Getenv("BOOTSTRAP_SERVERS") != "" {
+		meta.bootstrapServers = strings.Split(os.Getenv("BOOTSTRAP_SERVERS"), ",")
+	}
+	if os.Getenv("BROKER_LIST") != "" {
+		logger.Info("WARNING: usage of brokerList is deprecated. use bootstrapServers instead.")
+		meta.bootstrapServers = strings.Split(os.Getenv("BROKER_LIST"), ",")
+	}
+	if os.Getenv("CONSUMER_GROUP") == "" {
+		return meta, errors.New("no consumerGroup given")
+	}
+	meta.consumerGroup = os.Getenv("CONSUMER_GROUP")
+
+	// TOPIC is a comma separated list of topics or a regular expression matching them
+	topic := os.Getenv("TOPIC")
+	if pattern, ok := strings.CutPrefix(topic, topicRegexPrefix); ok {
+		var err error
+		meta.topicPattern, err = regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return meta, fmt.Errorf("failed to parse topic pattern: %w", err)
+		}
+	} else {
+		for _, t := range strings.Split(topic, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				meta.topics = append(meta.topics, t)
+			}
+		}
+		if len(meta.topics) == 0 {
+			return meta, errors.New("no topic given")
+		}
+	}
+	meta.topicRefreshInterval = defaultTopicRefreshInterval
+	if v := os.Getenv("TOPIC_REFRESH_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			return meta, fmt.Errorf("TOPIC_REFRESH_INTERVAL must be a positive duration, got %q", v)
+		}
+		meta.topicRefreshInterval = interval
+	}
+
+	meta.partitionWorkers = 1
+	if v := os.Getenv("PARTITION_WORKERS"); v != "" {
+		workers, err := strconv.Atoi(v)
+		if err != nil || workers < 1 {
+			return meta, fmt.Errorf("PARTITION_WORKERS must be a positive number, got %q", v)
+		}
+		meta.partitionWorkers = workers
+	}
+
+	tuning, err := parseConsumerTuning()
+	if err != nil {
+		return meta, err
+	}
+	meta.tuning = tuning
+	meta.producer, err = parseProducerTuning()
+	if err != nil {
+		return meta, err
+	}
+
+	if v := os.Getenv("EXACTLY_ONCE"); v != "" {
+		meta.exactlyOnce, err = strconv.ParseBool(v)
+		if err != nil {
+			return meta, fmt.Errorf("failed to parse value from EXACTLY_ONCE environment variable %v", err)
+		}
+	}
+	if meta.exactlyOnce && meta.partitionWorkers > 1 {
+		return meta, errors.New("EXACTLY_ONCE cannot be combined with PARTITION_WORKERS")
+	}
+	meta.failure, err = parseFailurePolicy()
+	if err != nil {
+		return meta, err
+	}
+	if meta.exactlyOnce && meta.producer.async {
+		return meta, errors.New("EXACTLY_ONCE cannot be combined with PRODUCER_ASYNC")
+	}
+	if meta.exactlyOnce && meta.failure.onFailure != onFailureSkip {
+		return meta, errors.New("EXACTLY_ONCE only supports the skip ON_FAILURE policy")
+	}
+	meta.retryDelays, err = parseRetryDelays()
+	if err != nil {
+		return meta, err
+	}
+	meta.transactionalIDPrefix = os.Getenv("TRANSACTIONAL_ID_PREFIX")
+	if meta.transactionalIDPrefix == "" {
+		meta.transactionalIDPrefix = meta.consumerGroup
+	}
+
+	offsetResetPolicy := os.Getenv("OFFSET_RESET_POLICY")
+
+	// If offsetResetPolicy is not set, use latest by default
+	if offsetResetPolicy == "" {
+		offsetResetPolicy = "latest"
+	}
+
+	// Check offsetResetPolicy is valid
+	if offsetResetPolicy != "earliest" && offsetResetPolicy != "latest" {
+		return meta, fmt.Errorf("offsetResetPolicy %s not support. It should be one of earliest or latest", offsetResetPolicy)
+	}
+	meta.offsetResetPolicy = offsetResetPolicy
+
+	meta.tls = os.Getenv("TLS")
+	if meta.tls == "" {
+		meta.tls = "disabled"
+	}
+
+	meta.saslType = os.Getenv("SASL")
+
+	if meta.saslType != kafkaAuthModeSaslPlaintext && meta.saslType != kafkaAuthModeNone && meta.saslType != kafkaAuthModeSaslScramSha256 && meta.saslType != kafkaAuthModeSaslScramSha512 && meta.saslType != kafkaAuthModeSaslOAuthBearer && meta.saslType != kafkaAuthModeSaslAWSMSKIAM {
+		return meta, fmt.Errorf("incorrect value for sasl authentication %s given", meta.saslType)
+	}
+	if err := meta.producer.check(kafkaVersion(meta)); err != nil {
+		return meta, err
+	}
+
+	if meta.saslType == kafkaAuthModeSaslOAuthBearer {
+		provider, err := newOAuthTokenProviderFromEnv()
+		if err != nil {
+			return meta, err
+		}
+		meta.tokenProvider = provider
+	} else if meta.saslType == kafkaAuthModeSaslAWSMSKIAM {
+		provider, err := newMSKIAMTokenProvider(context.Background())
+		if err != nil {
+			return meta, err
+		}
+		meta.tokenProvider = provider
+	} else if meta.saslType != kafkaAuthModeNone {
+		if os.Getenv("USERNAME") == "" {
+			return meta, errors.New("no username given")
+		}
+		meta.username = strings.TrimSpace(os.Getenv("USERNAME"))
+
+		if os.Getenv("PASSWORD") == "" {
+			return meta, errors.New("no password given")
+		}
+		meta.password = strings.TrimSpace(os.Getenv("PASSWORD"))
+	}
+
+	if meta.tls == "enable" {
+		// if either CERT or KEY are provided, both must be provided
+		if os.Getenv("CERT") != "" && os.Getenv("KEY") == "" {
+			return meta, errors.New("cert given but no key, both required")
+		}
+
+		if os.Getenv("KEY") != "" && os.Getenv("CERT") == "" {
+			return meta, errors.New("key given but no cert, both required")
+		}
+
+		// CA is optional
+		meta.ca = os.Getenv("CA")
+		// CERT and KEY must be provided as a pair, but both are optional
+		meta.cert = os.Getenv("CERT")
+		meta.key = os.Getenv("KEY")
+	}
+
+	return meta, nil
+}
+
+// End of code snippet from KEDA project.
+
+// kafkaVersion returns the version of the Kafka protocol the clients use, KAFKA_VERSION or
+// 2.0.0 by default
+func kafkaVersion(metadata kafkaMetadata) sarama.KafkaVersion {
+	version := sarama.V2_0_0_0
+	if metadata.tuning.version != (sarama.KafkaVersion{}) {
+		version = metadata.tuning.version
+	}
+	// Re-authenticating MSK IAM connections before their session expires requires Kafka 2.2
+	if metadata.saslType == kafkaAuthModeSaslAWSMSKIAM && !version.IsAtLeast(sarama.V2_2_0_0) {
+		version = sarama.V2_2_0_0
+	}
+	return version
+}
+
+func getConfig(metadata kafkaMetadata) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	config.Version = kafkaVersion(metadata)
+	metadata.tuning.apply(config)
+
+	// When offsetResetPolicy is earliest, set Consumer.Offsets.Initial to OffsetOldest.
+	// Otherwise, set Consumer.Offsets.Initial to OffsetNewest.
+	// Ref: https://github.com/Shopify/sarama/issues/803#issuecomment-269215508
+	if metadata.offsetResetPolicy == "earliest" {
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	} else {
+		config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	}
+
+	// Records of aborted transactions are never consumed in exactly-once mode
+	if metadata.exactlyOnce {
+		config.Consumer.IsolationLevel = sarama.ReadCommitted
+	}
+
+	if ok := metadata.saslType == kafkaAuthModeSaslPlaintext || metadata.saslType == kafkaAuthModeSaslScramSha256 || metadata.saslType == kafkaAuthModeSaslScramSha512; ok {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = metadata.username
+		config.Net.SASL.Password = metadata.password
+	}
+
+	if metadata.saslType == kafkaAuthModeSaslPlaintext {
+		config.Net.SASL.Mechanism = sarama.SASLMechanism(sarama.SASLTypePlaintext)
+	}
+
+	if metadata.saslType == kafkaAuthModeSaslScramSha256 {
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &XDGSCRAMClient{HashGeneratorFcn: SHA256} }
+		config.Net.SASL.Mechanism = sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA256)
+	}
+
+	if metadata.saslType == kafkaAuthModeSaslScramSha512 {
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &XDGSCRAMClient{HashGeneratorFcn: SHA512} }
+		config.Net.SASL.Mechanism = sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512)
+	}
+
+	if metadata.saslType == kafkaAuthModeSaslOAuthBearer {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.Mechanism = sarama.SASLTypeOAuth
+		config.Net.SASL.TokenProvider = metadata.tokenProvider
+	}
+
+	// MSK IAM tokens are sent with OAUTHBEARER over TLS
+	if metadata.saslType == kafkaAuthModeSaslAWSMSKIAM {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.Mechanism = sarama.SASLTypeOAuth
+		config.Net.SASL.TokenProvider = metadata.tokenProvider
+		config.Net.TLS.Enable = true
+	}
+
+	if metadata.tls == "enable" {
+		config.Net.TLS.Enable = true
+		tlsConfig, err := NewTLSConfig(metadata.cert, metadata.key, metadata.ca)
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	return config, nil
+}
+
+// kafkaConnector represents a Sarama consumer group consumer
+type kafkaConnector struct {
+	ready         chan bool
+	logger        *zap.Logger
+	metadata      kafkaMetadata
+	kafkaClient   sarama.Client
+	client        sarama.ConsumerGroup
+	handler       common.MessageHandler
+	connectorData common.ConnectorMetadata
+	// retry produces failed records to the retry topics, it is nil without RETRY_TOPIC_DELAYS
+	retry *retryTopics
+
+	mu     sync.Mutex
+	paused bool
+	// stopped holds the reason of the partitions stopped by the stop failure policy
+	stopped map[topicPartition]string
+	// stopSession ends the current consumer group session, which is then joined again
+	stopSession context.CancelFunc
+}
+
+// kafkaMessage is a record claimed by the consumer group
+type kafkaMessage struct {
+	session sarama.ConsumerGroupSession
+	record  *sarama.ConsumerMessage
+	headers http.Header
+	// tracker marks the offset when the partition is consumed concurrently
+	tracker *offsetTracker
+	// txn commits the offset in exactly-once mode
+	txn *recordTransaction
+	// acked is set once the record has been processed
+	acked bool
+	retry *retryTopics
+}
+
+func (m *kafkaMessage) Body() []byte         { return m.record.Value }
+func (m *kafkaMessage) Headers() http.Header { return m.headers }
+func (m *kafkaMessage) Key() string          { return string(m.record.Key) }
+
+// Position returns the topic, partition and offset of the record
+func (m *kafkaMessage) Position() map[string]string {
+	return map[string]string{
+		"topic":     m.record.Topic,
+		"partition": strconv.FormatInt(int64(m.record.Partition), 10),
+		"offset":    strconv.FormatInt(m.record.Offset, 10),
+	}
+}
+
+// Ack marks the offset of the record
+func (m *kafkaMessage) Ack() error {
+	m.acked = true
+	if m.txn != nil {
+		return m.txn.commit(m.record)
+	}
+	if m.tracker != nil {
+		m.tracker.complete(m.record.Offset)
+		return nil
+	}
+	m.session.MarkMessage(m.record, "")
+	return nil
+}
+
+// Nack leaves the offset of the record unmarked, the record is processed again or stops the
+// partition according to the failure policy
+func (m *kafkaMessage) Nack() error {
+	if m.txn != nil {
+		// The responses published so far are discarded and the record is processed again
+		m.txn.abort()
+	}
+	return nil
+}
+
+// Consume runs the consumer group session loop until ctx is cancelled
+func (conn *kafkaConnector) Consume(ctx context.Context, handler common.MessageHandler) error {
+	conn.handler = handler
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		for {
+			topics, err := conn.subscription()
+			if err != nil || len(topics) == 0 {
+				conn.logger.Warn("no topic to consume, waiting for matching topics",
+					zap.Error(err),
+					zap.Stringer("pattern", conn.metadata.topicPattern))
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(conn.metadata.topicRefreshInterval):
+				}
+				continue
+			}
+
+			// The session is restarted when the topics matching the pattern change
+			sessionCtx, stop := context.WithCancel(ctx)
+			conn.mu.Lock()
+			conn.stopSession = stop
+			conn.mu.Unlock()
+			if conn.metadata.topicPattern != nil {
+				go conn.watchTopics(sessionCtx, topics, stop)
+			}
+			if err := conn.client.Consume(sessionCtx, topics, conn); err != nil {
+				conn.logger.Error("Error from consumer", zap.Error(err))
+			}
+			stop()
+			// check if context was cancelled, signaling that the consumer should stop
+			if ctx.Err() != nil {
+				return
+			}
+			conn.ready = make(chan bool)
+		}
+	}()
+
+	select {
+	case <-conn.ready: // Await till the consumer has been set up
+		conn.logger.Info("Sarama consumer up and running!...")
+		<-ctx.Done()
+	case <-ctx.Done():
+	}
+	conn.logger.Info("terminating: context cancelled")
+	cancel()
+	wg.Wait()
+	if err := conn.client.Close(); err != nil {
+		return fmt.Errorf("error closing client: %w", err)
+	}
+	if err := conn.kafkaClient.Close(); err != nil && !errors.Is(err, sarama.ErrClosedClient) {
+		return fmt.Errorf("error closing client: %w", err)
+	}
+	return nil
+}
+
+// restartSession ends the current consumer group session, the partitions are consumed
+// again from their committed offsets once the group has been joined again
+func (conn *kafkaConnector) restartSession() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.stopSession != nil {
+		conn.stopSession()
+	}
+}
+
+// subscription returns the topics to consume, the topics matching the pattern are looked up
+// in the cluster metadata
+func (conn *kafkaConnector) subscription() ([]string, error) {
+	if conn.metadata.topicPattern == nil {
+		return withRetryTopics(conn.metadata.topics, conn.metadata.retryDelays), nil
+	}
+	if err := conn.kafkaClient.RefreshMetadata(); err != nil {
+		return nil, fmt.Errorf("failed to refresh metadata: %w", err)
+	}
+	all, err := conn.kafkaClient.Topics()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list topics: %w", err)
+	}
+	var topics []string
+	for _, topic := range all {
+		// Internal topics such as __consumer_offsets are never consumed, retry topics are
+		// subscribed to along with the topic they belong to
+		if strings.HasPrefix(topic, "__") || retryTopicSuffix.MatchString(topic) {
+			continue
+		}
+		if conn.metadata.topicPattern.MatchString(topic) {
+			topics = append(topics, topic)
+		}
+	}
+	topics = withRetryTopics(topics, conn.metadata.retryDelays)
+	sort.Strings(topics)
+	return topics, nil
+}
+
+// watchTopics calls stop once the topics matching the pattern differ from topics, so that
+// the consumer group session is rejoined with the new topics
+func (conn *kafkaConnector) watchTopics(ctx context.Context, topics []string, stop context.CancelFunc) {
+	ticker := time.NewTicker(conn.metadata.topicRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current, err := conn.subscription()
+		if err != nil {
+			conn.logger.Warn("failed to refresh topics", zap.Error(err))
+			continue
+		}
+		if !slices.Equal(current, topics) {
+			conn.logger.Info("topics matching the pattern changed, rejoining consumer group",
+				zap.Strings("topics", current))
+			stop()
+			return
+		}
+	}
+}
+
+// Pause pauses fetching from all claimed partitions
+func (conn *kafkaConnector) Pause() error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.paused = true
+	conn.client.PauseAll()
+	return nil
+}
+
+// Resume resumes fetching from all claimed partitions
+func (conn *kafkaConnector) Resume() error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.paused = false
+	conn.client.ResumeAll()
+	conn.pauseStopped()
+	return nil
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim
+func (conn *kafkaConnector) Setup(session sarama.ConsumerGroupSession) error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	// Stopped partitions claimed again stay paused, the others have been assigned to another
+	// member of the group which consumes them from their committed offset
+	claims := session.Claims()
+	for tp, reason := range conn.stopped {
+		if !slices.Contains(claims[tp.topic], tp.partition) {
+			delete(conn.stopped, tp)
+			common.ClearUnhealthy(reason)
+			conn.logger.Info("stopped partition assigned to another member of the group",
+				zap.String("topic", tp.topic),
+				zap.Int32("partition", tp.partition))
+		}
+	}
+	conn.pauseStopped()
+
+	close(conn.ready)
+	return nil
+}
+
+// pauseStopped pauses the stopped partitions, conn.mu must be held
+func (conn *kafkaConnector) pauseStopped() {
+	for tp := range conn.stopped {
+		conn.client.Pause(map[string][]int32{tp.topic: {tp.partition}})
+	}
+}
+
+// Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited
+func (conn *kafkaConnector) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim must start a consumer loop of ConsumerGroupClaim's Messages()
+func (conn *kafkaConnector) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+
+	// NOTE:
+	// Do not move the code below to a goroutine.
+	// The `ConsumeClaim` itself is called within a goroutine, see:
+	// https://github.com/Shopify/sarama/blob/master/consumer_group.go#L27-L29
+
+	// Partitions claimed after a rebalance start fetching, keep them paused
+	conn.mu.Lock()
+	if conn.paused {
+		conn.client.Pause(map[string][]int32{claim.Topic(): {claim.Partition()}})
+	}
+	_, stopped := conn.stopped[topicPartition{claim.Topic(), claim.Partition()}]
+	conn.mu.Unlock()
+	if stopped {
+		// The failed record is not consumed again until the connector is restarted
+		<-session.Context().Done()
+		return nil
+	}
+
+	switch {
+	case conn.metadata.exactlyOnce:
+		conn.consumeTransactionally(session, claim)
+	case conn.metadata.partitionWorkers > 1:
+		conn.consumeConcurrently(session, claim)
+	default:
+		for message := range claim.Messages() {
+			if !conn.process(session.Context(), session, message, nil) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// handle passes message to the handler and reports whether it was acknowledged, its offset
+// is marked by tracker when the partition is consumed concurrently and committed by txn in
+// exactly-once mode
+func (conn *kafkaConnector) handle(ctx context.Context, session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage, tracker *offsetTracker, txn *recordTransaction) bool {
+	conn.logger.Debug("message claimed",
+		zap.String("topic", message.Topic),
+		zap.Int32("partition", message.Partition),
+		zap.Int64("offset", message.Offset),
+		zap.Time("timestamp", message.Timestamp),
+		common.PayloadField("value", message.Value))
+
+	// The keys of KEDAHeaders are canonicalized, so that the headers set below replace them
+	// instead of being sent next to them
+	headers := http.Header{}
+	for key, values := range common.KEDAHeaders(conn.connectorData) {
+		headers[http.CanonicalHeaderKey(key)] = values
+	}
+
+	// Set the headers came from Kafka record
+	for _, h := range message.Headers {
+		if utf8.ValidString(string(h.Value)) {
+			headers.Set(string(h.Key), string(h.Value))
+		}
+	}
+
+	// The headers describing the record are set last, so that a record produced with the
+	// headers of another one, e.g. a response, does not carry its coordinates or key.
+	// TOPIC can name several topics, the function gets the one of the record, or the one it
+	// was first consumed from for a record of a retry topic
+	headers.Set("KEDA-Topic", originalTopic(message))
+	headers.Set("KEDA-Partition", strconv.FormatInt(int64(message.Partition), 10))
+	headers.Set("KEDA-Offset", strconv.FormatInt(message.Offset, 10))
+	headers.Del("KEDA-Timestamp")
+	if !message.Timestamp.IsZero() {
+		headers.Set("KEDA-Timestamp", message.Timestamp.UTC().Format(time.RFC3339Nano))
+	}
+	headers.Del("KEDA-Key")
+	headers.Del("KEDA-Key-Encoding")
+	if len(message.Key) > 0 {
+		// Header values are text, binary keys are sent base64 encoded
+		if utf8.Valid(message.Key) {
+			headers.Set("KEDA-Key", string(message.Key))
+		} else {
+			headers.Set("KEDA-Key", base64.StdEncoding.EncodeToString(message.Key))
+			headers.Set("KEDA-Key-Encoding", "base64")
+		}
+	}
+
+	msg := &kafkaMessage{
+		session: session,
+		record:  message,
+		headers: headers,
+		tracker: tracker,
+		txn:     txn,
+		retry:   conn.retry,
+	}
+	conn.handler(ctx, msg)
+	return msg.acked
+}
+
+// getProducerConfig returns the config of the producer of the response and error topics
+func getProducerConfig(metadata kafkaMetadata) (*sarama.Config, error) {
+	config, err := getConfig(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Producer.Retry.Max = 10
+	config.Producer.Return.Successes = true
+	metadata.producer.apply(config)
+	return config, nil
+}
+
+// Command runs the Kafka connector
+var Command = common.Command{
+	Name:        "kafka",
+	Description: "Consume records from Kafka topics and post them to an HTTP endpoint",
+	Run:         Run,
+	Headers:     common.KEDAHeaders,
+}
+
+// Run consumes records from the configured topics until ctx is cancelled
+func Run(ctx context.Context, logger *zap.Logger, connData common.ConnectorMetadata) error {
+	metadata, err := parseKafkaMetadata(logger)
+	if err != nil {
+		return fmt.Errorf("failed to fetch kafka metadata: %w", err)
+	}
+
+	config, err := getConfig(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to create kafka config: %w", err)
+	}
+
+	// In exactly-once mode responses are published by the transactional producer of the
+	// partition the record was consumed from
+	var sink common.Sink = transactionalSink{}
+	if metadata.exactlyOnce {
+		if connData.ResponseSink != "" || connData.ErrorSink != "" {
+			return errors.New("EXACTLY_ONCE cannot be combined with RESPONSE_SINK or ERROR_SINK")
+		}
+	} else {
+		sink, err = newKafkaSink(metadata, logger)
+		if err != nil {
+			return fmt.Errorf("failed to create kafka producer: %w", err)
+		}
+		defer sink.Close()
+	}
+
+	pipeline, err := common.NewPipeline(ctx, logger, connData, sink)
+	if err != nil {
+		return err
+	}
+	defer pipeline.Close()
+	// With the skip policy the offset of a failed record is committed once its error has
+	// been published, in exactly-once mode together with the error record
+	pipeline.AckAfterError = metadata.failure.onFailure == onFailureSkip
+	pipeline.AckOnlyIfErrorPublished = true
+	pipeline.ErrorPublishRetries = metadata.failure.publishRetries
+	// A record retried forever is only logged, publishing it would repeat its error on every
+	// attempt
+	pipeline.SkipErrorPublish = metadata.failure.onFailure == onFailureRetryForever
+
+	kafkaClient, err := sarama.NewClient(metadata.bootstrapServers, config)
+	if err != nil {
+		return fmt.Errorf("error creating kafka client: %w", err)
+	}
+	client, err := sarama.NewConsumerGroupFromClient(metadata.consumerGroup, kafkaClient)
+	if err != nil {
+		kafkaClient.Close()
+		return fmt.Errorf("error creating consumer group client: %w", err)
+	}
+
+	conn := kafkaConnector{
+		ready:         make(chan bool),
+		logger:        logger,
+		metadata:      metadata,
+		kafkaClient:   kafkaClient,
+		client:        client,
+		connectorData: connData,
+	}
+	if len(metadata.retryDelays) > 0 {
+		conn.retry = &retryTopics{delays: metadata.retryDelays, sink: sink}
+	}
+	common.RegisterPausable(&conn)
+	return conn.Consume(ctx, pipeline.Handle)
+}
+
+// NewTLSConfig returns a *tls.Config using the given ceClient cert, ceClient key,
+// and CA certificate. If none are appropriate, a nil *tls.Config is returned.
+// Ref: https://github.com/kedacore/keda/blob/154364276402783c08fa24e7968fd31b9f89b6a6/pkg/util/tls_config.go
+// TODO: Move this to common package as other connectors might need this
+func NewTLSConfig(clientCert, clientKey, caCert string) (*tls.Config, error) {
+	valid := false
+
+	config := &tls.Config{}
+
+	if clientCert != "" && clientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
+		if err != nil {
+			return nil, fmt.Errorf("error parse X509KeyPair: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+		valid = true
+	}
+
+	if caCert != "" {
+		caCertPool := x509.NewCertPool()
+		caCertPool.AppendCertsFromPEM([]byte(caCert))
+		config.RootCAs = caCertPool
+		config.InsecureSkipVerify = true
+		valid = true
+	}
+
+	if !valid {
+		config = nil
+	}
+
+	return config, nil
+}
@@ -0,0 +1,220 @@
+package connector
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+func TestParseKafkaMetadata(t *testing.T) {
+	base := map[string]string{
+		"BOOTSTRAP_SERVERS": "localhost:9092",
+		"CONSUMER_GROUP":    "group",
+		"TOPIC":             "orders",
+	}
+	tests := []struct {
+		name string
+		env  map[string]string
+		// err is a part of the error expected, empty if the metadata is valid
+		err string
+	}{
+		{name: "valid"},
+		{name: "no brokers", env: map[string]string{"BOOTSTRAP_SERVERS": ""}, err: "no bootstrapServers"},
+		{name: "brokers set twice", env: map[string]string{"BROKER_LIST": "localhost:9092"}, err: "cannot specify both"},
+		{name: "no consumer group", env: map[string]string{"CONSUMER_GROUP": ""}, err: "no consumerGroup"},
+		{name: "no topic", env: map[string]string{"TOPIC": " , "}, err: "no topic"},
+		{name: "cert without key", env: map[string]string{"TLS": "enable", "CERT": "cert"}, err: "cert given but no key"},
+		{name: "sasl without username", env: map[string]string{"SASL": kafkaAuthModeSaslPlaintext}, err: "no username"},
+		{name: "invalid sasl", env: map[string]string{"SASL": "kerberos"}, err: "incorrect value for sasl"},
+		{name: "sasl oauthbearer", env: map[string]string{"SASL": kafkaAuthModeSaslOAuthBearer, "OAUTH_TOKEN_URL": "http://idp/token", "OAUTH_CLIENT_ID": "client", "OAUTH_CLIENT_SECRET": "secret"}},
+		{name: "sasl oauthbearer without token url", env: map[string]string{"SASL": kafkaAuthModeSaslOAuthBearer}, err: "no OAUTH_TOKEN_URL"},
+		{name: "sasl aws_msk_iam", env: map[string]string{"SASL": kafkaAuthModeSaslAWSMSKIAM, "AWS_REGION": "eu-west-1"}},
+		{name: "sasl aws_msk_iam without region", env: map[string]string{"SASL": kafkaAuthModeSaslAWSMSKIAM, "AWS_REGION": "", "AWS_DEFAULT_REGION": "", "AWS_CONFIG_FILE": "/nonexistent"}, err: "no AWS_REGION"},
+		{name: "exactly once", env: map[string]string{"EXACTLY_ONCE": "true"}},
+		{name: "invalid exactly once", env: map[string]string{"EXACTLY_ONCE": "always"}, err: "EXACTLY_ONCE"},
+		{name: "exactly once with partition workers", env: map[string]string{"EXACTLY_ONCE": "true", "PARTITION_WORKERS": "4"}, err: "cannot be combined with PARTITION_WORKERS"},
+		{name: "retry forever", env: map[string]string{"ON_FAILURE": onFailureRetryForever, "RETRY_BACKOFF": "2s", "RETRY_MAX_BACKOFF": "1m"}},
+		{name: "invalid failure policy", env: map[string]string{"ON_FAILURE": "ignore"}, err: "invalid ON_FAILURE"},
+		{name: "max backoff below backoff", env: map[string]string{"RETRY_BACKOFF": "2m", "RETRY_MAX_BACKOFF": "1m"}, err: "must not be lower than RETRY_BACKOFF"},
+		{name: "negative error publish retries", env: map[string]string{"ERROR_PUBLISH_RETRIES": "-1"}, err: "ERROR_PUBLISH_RETRIES"},
+		{name: "exactly once with stop", env: map[string]string{"EXACTLY_ONCE": "true", "ON_FAILURE": onFailureStop}, err: "only supports the skip ON_FAILURE policy"},
+		{name: "retry topics", env: map[string]string{"RETRY_TOPIC_DELAYS": "10s,1m"}},
+		{name: "invalid retry topic delay", env: map[string]string{"RETRY_TOPIC_DELAYS": "10s,later"}, err: "RETRY_TOPIC_DELAYS"},
+		{name: "idempotent producer", env: map[string]string{"PRODUCER_IDEMPOTENT": "true", "PRODUCER_ACKS": "all"}},
+		{name: "idempotent producer without acks all", env: map[string]string{"PRODUCER_IDEMPOTENT": "true"}, err: "requires PRODUCER_ACKS all"},
+		{name: "invalid producer acks", env: map[string]string{"PRODUCER_ACKS": "some"}, err: "invalid PRODUCER_ACKS"},
+		{name: "zstd", env: map[string]string{"PRODUCER_COMPRESSION": "zstd", "KAFKA_VERSION": "2.1.0"}},
+		{name: "zstd with default kafka version", env: map[string]string{"PRODUCER_COMPRESSION": "zstd"}, err: "requires KAFKA_VERSION 2.1.0"},
+		{name: "invalid compression", env: map[string]string{"PRODUCER_COMPRESSION": "brotli"}, err: "invalid PRODUCER_COMPRESSION"},
+		{name: "exactly once with async producer", env: map[string]string{"EXACTLY_ONCE": "true", "PRODUCER_ASYNC": "true"}, err: "cannot be combined with PRODUCER_ASYNC"},
+		{name: "invalid offset reset policy", env: map[string]string{"OFFSET_RESET_POLICY": "oldest"}, err: "offsetResetPolicy oldest"},
+		{name: "kafka version", env: map[string]string{"KAFKA_VERSION": "3.6.0"}},
+		{name: "negotiated kafka version", env: map[string]string{"KAFKA_VERSION": "auto"}},
+		{name: "invalid kafka version", env: map[string]string{"KAFKA_VERSION": "latest"}, err: "invalid KAFKA_VERSION"},
+		{name: "sticky rebalance strategy", env: map[string]string{"REBALANCE_STRATEGY": "Sticky"}},
+		{name: "cooperative-sticky rebalance strategy", env: map[string]string{"REBALANCE_STRATEGY": "cooperative-sticky"}, err: "not supported"},
+		{name: "invalid rebalance strategy", env: map[string]string{"REBALANCE_STRATEGY": "random"}, err: "invalid REBALANCE_STRATEGY"},
+		{name: "invalid session timeout", env: map[string]string{"SESSION_TIMEOUT": "0s"}, err: "SESSION_TIMEOUT must be a positive duration"},
+		{name: "heartbeat above session timeout", env: map[string]string{"SESSION_TIMEOUT": "5s", "HEARTBEAT_INTERVAL": "5s"}, err: "must be lower than SESSION_TIMEOUT"},
+		{name: "heartbeat above default session timeout", env: map[string]string{"HEARTBEAT_INTERVAL": "15s"}, err: "must be lower than SESSION_TIMEOUT"},
+		{name: "invalid fetch size", env: map[string]string{"FETCH_MAX_BYTES": "-1"}, err: "FETCH_MAX_BYTES must be a positive number"},
+		{name: "fetch min above default", env: map[string]string{"FETCH_MIN_BYTES": "2048", "FETCH_DEFAULT_BYTES": "1024"}, err: "FETCH_MIN_BYTES must not be greater"},
+		{name: "fetch default above max", env: map[string]string{"FETCH_DEFAULT_BYTES": "2048", "FETCH_MAX_BYTES": "1024"}, err: "FETCH_DEFAULT_BYTES must not be greater"},
+		{name: "invalid channel buffer size", env: map[string]string{"CHANNEL_BUFFER_SIZE": "0"}, err: "CHANNEL_BUFFER_SIZE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range base {
+				t.Setenv(key, value)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			_, err := parseKafkaMetadata(zap.NewNop())
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.err != "" && err == nil:
+				t.Errorf("expected an error containing %q", tt.err)
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Errorf("error %q does not contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestConsumerTuningApply(t *testing.T) {
+	t.Setenv("KAFKA_VERSION", "3.6.0")
+	t.Setenv("REBALANCE_STRATEGY", "roundrobin")
+	t.Setenv("SESSION_TIMEOUT", "30s")
+	t.Setenv("FETCH_MAX_BYTES", "4096")
+	t.Setenv("CHANNEL_BUFFER_SIZE", "16")
+	tuning, err := parseConsumerTuning()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := sarama.NewConfig()
+	defaults := sarama.NewConfig()
+	tuning.apply(config)
+	if config.Version != sarama.V3_6_0_0 || config.Consumer.Group.Session.Timeout != 30*time.Second ||
+		config.Consumer.Fetch.Max != 4096 || config.ChannelBufferSize != 16 {
+		t.Errorf("tuning not applied: version %v, session timeout %v, fetch max %d, buffer %d",
+			config.Version, config.Consumer.Group.Session.Timeout, config.Consumer.Fetch.Max, config.ChannelBufferSize)
+	}
+	if strategies := config.Consumer.Group.Rebalance.GroupStrategies; len(strategies) != 1 || strategies[0].Name() != "roundrobin" {
+		t.Errorf("rebalance strategies %v", strategies)
+	}
+	if config.Consumer.Group.Heartbeat.Interval != defaults.Consumer.Group.Heartbeat.Interval || config.Consumer.Fetch.Min != defaults.Consumer.Fetch.Min {
+		t.Error("settings which are not configured changed")
+	}
+}
+
+// functionServer starts a function answering every record with status and body
+func functionServer(t *testing.T, status int, body string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// newTestConnector returns a connector passing records to a pipeline invoking endpoint
+// and publishing to sink
+func newTestConnector(t *testing.T, endpoint string, sink common.Sink) (*kafkaConnector, *common.Pipeline) {
+	t.Helper()
+	t.Setenv("TAP_OUTPUT", "")
+	data := common.ConnectorMetadata{HTTPEndpoint: endpoint, ResponseTopic: "responses", ErrorTopic: "errors"}
+	pipeline, err := common.NewPipeline(context.Background(), zap.NewNop(), data, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = pipeline.Close() })
+	pipeline.AckOnlyIfErrorPublished = true
+	return &kafkaConnector{logger: zap.NewNop(), connectorData: data, handler: pipeline.Handle}, pipeline
+}
+
+func TestHandleHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		record *sarama.ConsumerMessage
+		want   map[string]string
+	}{
+		{
+			name: "text key",
+			record: &sarama.ConsumerMessage{
+				Topic: "orders", Partition: 2, Offset: 41, Key: []byte("order-1"),
+				Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				Headers:   []*sarama.RecordHeader{{Key: []byte("X-Trace"), Value: []byte("1")}, {Key: []byte("X-Binary"), Value: []byte{0xff}}},
+			},
+			want: map[string]string{
+				"KEDA-Topic": "orders", "KEDA-Partition": "2", "KEDA-Offset": "41", "KEDA-Key": "order-1",
+				"KEDA-Timestamp": "2024-01-02T03:04:05Z", "X-Trace": "1", "X-Binary": "", "KEDA-Key-Encoding": "",
+			},
+		},
+		{
+			name:   "binary key",
+			record: &sarama.ConsumerMessage{Topic: "orders", Key: []byte{0xff, 0x00}},
+			want:   map[string]string{"KEDA-Key": "/wA=", "KEDA-Key-Encoding": "base64"},
+		},
+		{
+			// A response produced with the headers of the record it answers
+			name: "headers of another record",
+			record: &sarama.ConsumerMessage{
+				Topic: "responses", Partition: 0, Offset: 7, Key: []byte("order-2"),
+				Headers: []*sarama.RecordHeader{
+					{Key: []byte("Keda-Partition"), Value: []byte("2")},
+					{Key: []byte("Keda-Offset"), Value: []byte("41")},
+					{Key: []byte("Keda-Timestamp"), Value: []byte("2024-01-02T03:04:05Z")},
+					{Key: []byte("Keda-Key"), Value: []byte("/wA=")},
+					{Key: []byte("Keda-Key-Encoding"), Value: []byte("base64")},
+				},
+			},
+			want: map[string]string{"KEDA-Partition": "0", "KEDA-Offset": "7", "KEDA-Key": "order-2", "KEDA-Key-Encoding": "", "KEDA-Timestamp": ""},
+		},
+		{
+			name:   "no key",
+			record: &sarama.ConsumerMessage{Topic: "orders", Headers: []*sarama.RecordHeader{{Key: []byte("KEDA-Key"), Value: []byte("order-1")}}},
+			want:   map[string]string{"KEDA-Key": ""},
+		},
+		{
+			name:   "retry record",
+			record: retryRecord(1, time.Now()),
+			want:   map[string]string{"KEDA-Topic": "orders", "KEDA-Offset": "3", "KEDA-Original-Offset": "41"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan http.Header, 1)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received <- r.Header
+			}))
+			defer srv.Close()
+			conn, _ := newTestConnector(t, srv.URL, &publishingSink{})
+
+			conn.handle(context.Background(), &markingSession{}, tt.record, nil, nil)
+			headers := <-received
+			if values := headers.Values("KEDA-Topic"); len(values) != 1 {
+				t.Errorf("KEDA-Topic sent %d times", len(values))
+			}
+			for key, value := range tt.want {
+				if got := headers.Get(key); got != value {
+					t.Errorf("header %s is %q, want %q", key, got, value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package connector
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+const (
+	// mskTokenLifetime is the validity of the presigned URLs used as tokens
+	mskTokenLifetime = 15 * time.Minute
+	// mskTokenRefreshBefore is how long before its expiry a token is replaced
+	mskTokenRefreshBefore = time.Minute
+	// emptyPayloadHash is the SHA-256 hash of an empty payload
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// mskIAMTokenProvider implements sarama.AccessTokenProvider for Amazon MSK clusters with IAM
+// access control. The token is a URL for the kafka-cluster:Connect action presigned with
+// SigV4, using the same credential chain as the other AWS connectors. The credentials are
+// refreshed by the AWS SDK, and the brokers re-authenticate long-lived connections with a
+// new token before the session expires.
+type mskIAMTokenProvider struct {
+	region      string
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newMSKIAMTokenProvider(ctx context.Context) (*mskIAMTokenProvider, error) {
+	config, err := common.GetAwsConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load aws config: %w", err)
+	}
+	if config.Region == "" {
+		return nil, errors.New("no AWS_REGION given, it is required by aws_msk_iam")
+	}
+	return &mskIAMTokenProvider{
+		region:      config.Region,
+		credentials: config.Credentials,
+		signer:      v4.NewSigner(),
+	}, nil
+}
+
+// Token returns the cached token, presigning a new one when it is about to expire
+func (p *mskIAMTokenProvider) Token() (*sarama.AccessToken, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if p.token != "" && now.Before(p.expires.Add(-mskTokenRefreshBefore)) {
+		return &sarama.AccessToken{Token: p.token}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	credentials, err := p.credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve aws credentials: %w", err)
+	}
+
+	query := url.Values{
+		"Action":        {"kafka-cluster:Connect"},
+		"X-Amz-Expires": {fmt.Sprint(int(mskTokenLifetime.Seconds()))},
+	}
+	endpoint := fmt.Sprintf("https://kafka.%s.amazonaws.com/?%s", p.region, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	signed, _, err := p.signer.PresignHTTP(ctx, credentials, req, emptyPayloadHash, "kafka-cluster", p.region, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign msk iam token: %w", err)
+	}
+	signedURL, err := url.Parse(signed)
+	if err != nil {
+		return nil, err
+	}
+	query = signedURL.Query()
+	query.Set("User-Agent", "fission-keda-connectors")
+	signedURL.RawQuery = query.Encode()
+
+	// The token is only valid as long as the credentials it was signed with
+	p.token = base64.RawURLEncoding.EncodeToString([]byte(signedURL.String()))
+	p.expires = now.Add(mskTokenLifetime)
+	if credentials.CanExpire && credentials.Expires.Before(p.expires) {
+		p.expires = credentials.Expires
+	}
+	return &sarama.AccessToken{Token: p.token}, nil
+}
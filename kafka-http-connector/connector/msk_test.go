@@ -0,0 +1,124 @@
+package connector
+
+import (
+	"context"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// decodeMSKToken returns the presigned URL of a token
+func decodeMSKToken(t *testing.T, token string) *url.URL {
+	t.Helper()
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		t.Fatalf("token is not base64url encoded: %v", err)
+	}
+	u, err := url.Parse(string(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestNewMSKIAMTokenProvider(t *testing.T) {
+	t.Setenv("AWS_CONFIG_FILE", "/nonexistent")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/nonexistent")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	if _, err := newMSKIAMTokenProvider(context.Background()); err == nil {
+		t.Error("provider created without AWS_REGION")
+	}
+
+	t.Setenv("AWS_REGION", "eu-west-1")
+	provider, err := newMSKIAMTokenProvider(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.region != "eu-west-1" {
+		t.Errorf("region %q", provider.region)
+	}
+}
+
+func TestMSKIAMTokenProvider(t *testing.T) {
+	var retrieved int
+	provider := &mskIAMTokenProvider{
+		region: "eu-west-1",
+		credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			retrieved++
+			return aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", SessionToken: "session"}, nil
+		}),
+		signer: v4.NewSigner(),
+	}
+
+	token, err := provider.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := decodeMSKToken(t, token.Token)
+	query := u.Query()
+	if u.Host != "kafka.eu-west-1.amazonaws.com" || query.Get("Action") != "kafka-cluster:Connect" {
+		t.Errorf("token signs %s", u)
+	}
+	if query.Get("X-Amz-Expires") != "900" || query.Get("X-Amz-Security-Token") != "session" || query.Get("X-Amz-Signature") == "" {
+		t.Errorf("token is not presigned: %s", u.RawQuery)
+	}
+	if credential := query.Get("X-Amz-Credential"); !strings.HasPrefix(credential, "AKIDEXAMPLE/") {
+		t.Errorf("token signed with credential %q", credential)
+	}
+	if query.Get("User-Agent") == "" {
+		t.Error("token has no User-Agent")
+	}
+
+	// The token is cached until shortly before it expires
+	cached, err := provider.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.Token != token.Token || retrieved != 1 {
+		t.Errorf("token presigned again, credentials retrieved %d times", retrieved)
+	}
+
+	provider.expires = time.Now().Add(mskTokenRefreshBefore / 2)
+	if _, err := provider.Token(); err != nil {
+		t.Fatal(err)
+	}
+	if retrieved != 2 {
+		t.Error("token about to expire not presigned again")
+	}
+}
+
+func TestMSKIAMTokenProviderExpiringCredentials(t *testing.T) {
+	expires := time.Now().Add(5 * time.Minute)
+	provider := &mskIAMTokenProvider{
+		region: "eu-west-1",
+		credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", CanExpire: true, Expires: expires}, nil
+		}),
+		signer: v4.NewSigner(),
+	}
+	if _, err := provider.Token(); err != nil {
+		t.Fatal(err)
+	}
+	if !provider.expires.Equal(expires) {
+		t.Errorf("token expires at %v, want the expiry of the credentials %v", provider.expires, expires)
+	}
+}
+
+func TestKafkaVersionMSKIAM(t *testing.T) {
+	metadata := kafkaMetadata{saslType: kafkaAuthModeSaslAWSMSKIAM}
+	metadata.tuning.version = sarama.V2_1_0_0
+	if version := kafkaVersion(metadata); version != sarama.V2_2_0_0 {
+		t.Errorf("version %s, want at least 2.2.0 to re-authenticate", version)
+	}
+	metadata.tuning.version = sarama.V3_6_0_0
+	if version := kafkaVersion(metadata); version != sarama.V3_6_0_0 {
+		t.Errorf("version %s, want the configured 3.6.0", version)
+	}
+}
@@ -0,0 +1,92 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const defaultTokenRefreshBefore = time.Minute
+
+// oauthTokenProvider implements sarama.AccessTokenProvider with the OAuth 2.0 client
+// credentials flow. Tokens are cached and fetched again shortly before they expire, the
+// provider is shared by the consumer group and the producer.
+type oauthTokenProvider struct {
+	source     oauth2.TokenSource
+	extensions map[string]string
+}
+
+// clientCredentialsSource fetches a new token on every call, caching is left to
+// oauth2.ReuseTokenSourceWithExpiry
+type clientCredentialsSource struct {
+	config *clientcredentials.Config
+}
+
+// newOAuthTokenProviderFromEnv creates a token provider from the OAUTH_* environment variables
+func newOAuthTokenProviderFromEnv() (*oauthTokenProvider, error) {
+	config := &clientcredentials.Config{
+		TokenURL:     os.Getenv("OAUTH_TOKEN_URL"),
+		ClientID:     strings.TrimSpace(os.Getenv("OAUTH_CLIENT_ID")),
+		ClientSecret: strings.TrimSpace(os.Getenv("OAUTH_CLIENT_SECRET")),
+	}
+	if config.TokenURL == "" {
+		return nil, errors.New("no OAUTH_TOKEN_URL given")
+	}
+	if config.ClientID == "" || config.ClientSecret == "" {
+		return nil, errors.New("OAUTH_CLIENT_ID and OAUTH_CLIENT_SECRET are required")
+	}
+	for _, scope := range strings.Split(os.Getenv("OAUTH_SCOPES"), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			config.Scopes = append(config.Scopes, scope)
+		}
+	}
+
+	// Extensions are sent to the broker with the token, e.g. logicalCluster=lkc-123 for Confluent Cloud
+	extensions := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv("OAUTH_EXTENSIONS"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid OAUTH_EXTENSIONS entry %q, must be key=value", pair)
+		}
+		extensions[key] = value
+	}
+
+	refreshBefore := defaultTokenRefreshBefore
+	if v := os.Getenv("OAUTH_REFRESH_BEFORE"); v != "" {
+		var err error
+		refreshBefore, err = time.ParseDuration(v)
+		if err != nil || refreshBefore < 0 {
+			return nil, fmt.Errorf("OAUTH_REFRESH_BEFORE must be a duration, got %q", v)
+		}
+	}
+
+	return &oauthTokenProvider{
+		source:     oauth2.ReuseTokenSourceWithExpiry(nil, clientCredentialsSource{config: config}, refreshBefore),
+		extensions: extensions,
+	}, nil
+}
+
+func (s clientCredentialsSource) Token() (*oauth2.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return s.config.Token(ctx)
+}
+
+// Token returns the cached access token, fetching a new one when it is about to expire
+func (p *oauthTokenProvider) Token() (*sarama.AccessToken, error) {
+	token, err := p.source.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch oauth token: %w", err)
+	}
+	return &sarama.AccessToken{Token: token.AccessToken, Extensions: p.extensions}, nil
+}
@@ -0,0 +1,148 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// tokenServer starts an OAuth token endpoint issuing tokens valid for expiresIn seconds,
+// it returns the endpoint and the number of tokens issued
+func tokenServer(t *testing.T, expiresIn int) (string, *atomic.Int32) {
+	t.Helper()
+	var issued atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := issued.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": fmt.Sprintf("token-%d", n),
+			"token_type":   "bearer",
+			"expires_in":   expiresIn,
+			"scope":        r.PostForm.Get("scope"),
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &issued
+}
+
+// setOAuthEnv sets the OAUTH_* variables of a test, the others are cleared
+func setOAuthEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for _, key := range []string{"OAUTH_TOKEN_URL", "OAUTH_CLIENT_ID", "OAUTH_CLIENT_SECRET", "OAUTH_SCOPES", "OAUTH_EXTENSIONS", "OAUTH_REFRESH_BEFORE"} {
+		t.Setenv(key, env[key])
+	}
+}
+
+func TestNewOAuthTokenProviderFromEnv(t *testing.T) {
+	credentials := map[string]string{"OAUTH_TOKEN_URL": "http://idp/token", "OAUTH_CLIENT_ID": "client", "OAUTH_CLIENT_SECRET": "secret"}
+	with := func(env map[string]string) map[string]string {
+		merged := map[string]string{}
+		for key, value := range credentials {
+			merged[key] = value
+		}
+		for key, value := range env {
+			merged[key] = value
+		}
+		return merged
+	}
+	tests := []struct {
+		name string
+		env  map[string]string
+		err  bool
+	}{
+		{name: "client credentials", env: credentials},
+		{name: "no token url", env: with(map[string]string{"OAUTH_TOKEN_URL": ""}), err: true},
+		{name: "no client secret", env: with(map[string]string{"OAUTH_CLIENT_SECRET": " "}), err: true},
+		{name: "invalid extension", env: with(map[string]string{"OAUTH_EXTENSIONS": "logicalCluster"}), err: true},
+		{name: "negative refresh", env: with(map[string]string{"OAUTH_REFRESH_BEFORE": "-1m"}), err: true},
+		{name: "invalid refresh", env: with(map[string]string{"OAUTH_REFRESH_BEFORE": "soon"}), err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setOAuthEnv(t, tt.env)
+			_, err := newOAuthTokenProviderFromEnv()
+			if tt.err && err == nil {
+				t.Error("expected an error")
+			} else if !tt.err && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestOAuthTokenProvider(t *testing.T) {
+	tokenURL, issued := tokenServer(t, 3600)
+	setOAuthEnv(t, map[string]string{
+		"OAUTH_TOKEN_URL":     tokenURL,
+		"OAUTH_CLIENT_ID":     "client",
+		"OAUTH_CLIENT_SECRET": "secret",
+		"OAUTH_SCOPES":        "kafka, ",
+		"OAUTH_EXTENSIONS":    "logicalCluster=lkc-123, identityPoolId=pool-1",
+	})
+	provider, err := newOAuthTokenProviderFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		token, err := provider.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.Token != "token-1" {
+			t.Errorf("token %q, want the cached token-1", token.Token)
+		}
+		if token.Extensions["logicalCluster"] != "lkc-123" || token.Extensions["identityPoolId"] != "pool-1" {
+			t.Errorf("extensions %v", token.Extensions)
+		}
+	}
+	if n := issued.Load(); n != 1 {
+		t.Errorf("%d tokens fetched, want 1", n)
+	}
+}
+
+func TestOAuthTokenProviderRefresh(t *testing.T) {
+	// Tokens expiring within OAUTH_REFRESH_BEFORE are fetched again on every call
+	tokenURL, issued := tokenServer(t, 30)
+	setOAuthEnv(t, map[string]string{
+		"OAUTH_TOKEN_URL":      tokenURL,
+		"OAUTH_CLIENT_ID":      "client",
+		"OAUTH_CLIENT_SECRET":  "secret",
+		"OAUTH_REFRESH_BEFORE": "1m",
+	})
+	provider, err := newOAuthTokenProviderFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if _, err := provider.Token(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := issued.Load(); n != 2 {
+		t.Errorf("%d tokens fetched, want 2", n)
+	}
+}
+
+func TestOAuthTokenProviderError(t *testing.T) {
+	tokenURL, _ := tokenServer(t, 3600)
+	setOAuthEnv(t, map[string]string{"OAUTH_TOKEN_URL": tokenURL, "OAUTH_CLIENT_ID": "client", "OAUTH_CLIENT_SECRET": "wrong"})
+	provider, err := newOAuthTokenProviderFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Token(); err == nil {
+		t.Error("token fetched with invalid client credentials")
+	}
+}
@@ -0,0 +1,239 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+// Metrics of the records produced by the async producer
+const (
+	metricProducerSuccesses = "kafka_producer_successes"
+	metricProducerErrors    = "kafka_producer_errors"
+)
+
+// producerTuning holds the settings of the producer of the response and error topics, zero
+// values keep the defaults
+type producerTuning struct {
+	acks            sarama.RequiredAcks
+	idempotent      bool
+	compression     sarama.CompressionCodec
+	maxMessageBytes int
+	linger          time.Duration
+	flushMessages   int
+	flushBytes      int
+	// async publishes records without waiting for the brokers to acknowledge them
+	async bool
+	// transactionalBatches publishes the parts of split responses in a transaction
+	transactionalBatches bool
+}
+
+// parseProducerTuning reads the producer settings from the environment
+func parseProducerTuning() (producerTuning, error) {
+	tuning := producerTuning{acks: sarama.WaitForLocal}
+
+	switch v := strings.ToLower(os.Getenv("PRODUCER_ACKS")); v {
+	case "", "local":
+	case "none":
+		tuning.acks = sarama.NoResponse
+	case "all":
+		tuning.acks = sarama.WaitForAll
+	default:
+		return tuning, fmt.Errorf("invalid PRODUCER_ACKS %q, must be one of none, local or all", v)
+	}
+
+	var err error
+	if v := os.Getenv("PRODUCER_IDEMPOTENT"); v != "" {
+		tuning.idempotent, err = strconv.ParseBool(v)
+		if err != nil {
+			return tuning, fmt.Errorf("failed to parse value from PRODUCER_IDEMPOTENT environment variable %v", err)
+		}
+	}
+	if tuning.idempotent && tuning.acks != sarama.WaitForAll {
+		return tuning, errors.New("PRODUCER_IDEMPOTENT requires PRODUCER_ACKS all")
+	}
+
+	if v := strings.ToLower(os.Getenv("PRODUCER_COMPRESSION")); v != "" {
+		if err := tuning.compression.UnmarshalText([]byte(v)); err != nil {
+			return tuning, fmt.Errorf("invalid PRODUCER_COMPRESSION %q, must be one of none, gzip, snappy, lz4 or zstd", v)
+		}
+	}
+
+	maxMessageBytes, err := envInt32("PRODUCER_MAX_MESSAGE_BYTES")
+	if err != nil {
+		return tuning, err
+	}
+	tuning.maxMessageBytes = int(maxMessageBytes)
+	if tuning.linger, err = envDuration("PRODUCER_LINGER"); err != nil {
+		return tuning, err
+	}
+	if v := os.Getenv("PRODUCER_FLUSH_MESSAGES"); v != "" {
+		tuning.flushMessages, err = strconv.Atoi(v)
+		if err != nil || tuning.flushMessages <= 0 {
+			return tuning, fmt.Errorf("PRODUCER_FLUSH_MESSAGES must be a positive number of records, got %q", v)
+		}
+	}
+	flushBytes, err := envInt32("PRODUCER_FLUSH_BYTES")
+	if err != nil {
+		return tuning, err
+	}
+	tuning.flushBytes = int(flushBytes)
+
+	if v := os.Getenv("PRODUCER_ASYNC"); v != "" {
+		tuning.async, err = strconv.ParseBool(v)
+		if err != nil {
+			return tuning, fmt.Errorf("failed to parse value from PRODUCER_ASYNC environment variable %v", err)
+		}
+	}
+	if v := os.Getenv("TRANSACTIONAL_BATCHES"); v != "" {
+		tuning.transactionalBatches, err = strconv.ParseBool(v)
+		if err != nil {
+			return tuning, fmt.Errorf("failed to parse value from TRANSACTIONAL_BATCHES environment variable %v", err)
+		}
+	}
+	return tuning, nil
+}
+
+// check returns an error if the settings are not supported by the Kafka version
+func (t producerTuning) check(version sarama.KafkaVersion) error {
+	if t.compression == sarama.CompressionZSTD && !version.IsAtLeast(sarama.V2_1_0_0) {
+		return fmt.Errorf("PRODUCER_COMPRESSION zstd requires KAFKA_VERSION 2.1.0 or later, got %s", version)
+	}
+	return nil
+}
+
+// apply sets the configured settings on config
+func (t producerTuning) apply(config *sarama.Config) {
+	config.Producer.RequiredAcks = t.acks
+	config.Producer.Compression = t.compression
+	if t.idempotent {
+		config.Producer.Idempotent = true
+		config.Net.MaxOpenRequests = 1
+	}
+	if t.maxMessageBytes > 0 {
+		config.Producer.MaxMessageBytes = t.maxMessageBytes
+	}
+	if t.linger > 0 {
+		config.Producer.Flush.Frequency = t.linger
+	}
+	if t.flushMessages > 0 {
+		config.Producer.Flush.Messages = t.flushMessages
+	}
+	if t.flushBytes > 0 {
+		config.Producer.Flush.Bytes = t.flushBytes
+	}
+}
+
+// asyncKafkaSink publishes messages with a Sarama async producer. Publish returns once the
+// record is queued, delivery failures are only logged and counted.
+//
+// Durable messages, such as the errors and retries of failed records, are published by a
+// sync producer instead, the offset of a failed record is only committed once they have
+// been acknowledged.
+type asyncKafkaSink struct {
+	producer        sarama.AsyncProducer
+	acknowledged    *kafkaSink
+	logger          *zap.Logger
+	maxMessageBytes int
+	wg              sync.WaitGroup
+}
+
+func newAsyncKafkaSink(producer sarama.AsyncProducer, acknowledged *kafkaSink, maxMessageBytes int, logger *zap.Logger) *asyncKafkaSink {
+	s := &asyncKafkaSink{
+		producer:        producer,
+		acknowledged:    acknowledged,
+		logger:          logger,
+		maxMessageBytes: maxMessageBytes,
+	}
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		for range producer.Successes() {
+			common.IncMetric(metricProducerSuccesses)
+		}
+	}()
+	go func() {
+		defer s.wg.Done()
+		for err := range producer.Errors() {
+			common.IncMetric(metricProducerErrors)
+			s.logger.Error("failed to produce record",
+				zap.Error(err.Err),
+				zap.String("topic", err.Msg.Topic))
+		}
+	}()
+	return s
+}
+
+func (s *asyncKafkaSink) Publish(ctx context.Context, msg common.SinkMessage) error {
+	if msg.Durable {
+		return s.acknowledged.Publish(ctx, msg)
+	}
+	select {
+	case s.producer.Input() <- producerMessage(msg):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *asyncKafkaSink) MaxMessageSize() int {
+	return s.maxMessageBytes
+}
+
+// Size counts the value, key and headers of the record
+func (s *asyncKafkaSink) Size(msg common.SinkMessage) int {
+	return msg.Size()
+}
+
+// Close flushes the queued records
+func (s *asyncKafkaSink) Close() error {
+	s.producer.AsyncClose()
+	s.wg.Wait()
+	return s.acknowledged.Close()
+}
+
+// newKafkaSink creates the sink of the response and error topics
+func newKafkaSink(metadata kafkaMetadata, logger *zap.Logger) (common.Sink, error) {
+	sink, err := newRecordSink(metadata, logger)
+	if err != nil || !metadata.producer.transactionalBatches {
+		return sink, err
+	}
+	batchSink, err := newTransactionalBatchSink(metadata, sink)
+	if err != nil {
+		_ = sink.Close()
+		return nil, err
+	}
+	return batchSink, nil
+}
+
+// newRecordSink creates the sink publishing messages one by one
+func newRecordSink(metadata kafkaMetadata, logger *zap.Logger) (common.SizeLimitedSink, error) {
+	config, err := getProducerConfig(metadata)
+	if err != nil {
+		return nil, err
+	}
+	producer, err := sarama.NewSyncProducer(metadata.bootstrapServers, config)
+	if err != nil {
+		return nil, err
+	}
+	sink := &kafkaSink{producer: producer, maxMessageBytes: config.Producer.MaxMessageBytes}
+	if !metadata.producer.async {
+		return sink, nil
+	}
+	asyncProducer, err := sarama.NewAsyncProducer(metadata.bootstrapServers, config)
+	if err != nil {
+		_ = sink.Close()
+		return nil, err
+	}
+	return newAsyncKafkaSink(asyncProducer, sink, config.Producer.MaxMessageBytes, logger), nil
+}
@@ -0,0 +1,140 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+func TestProducerTuningCheck(t *testing.T) {
+	zstd := producerTuning{compression: sarama.CompressionZSTD}
+	if err := zstd.check(sarama.V2_0_0_0); err == nil {
+		t.Error("zstd accepted with Kafka 2.0.0")
+	}
+	if err := zstd.check(sarama.V2_1_0_0); err != nil {
+		t.Errorf("zstd rejected with Kafka 2.1.0: %v", err)
+	}
+	if err := (producerTuning{compression: sarama.CompressionGZIP}).check(sarama.V0_11_0_0); err != nil {
+		t.Errorf("gzip rejected: %v", err)
+	}
+}
+
+func TestProducerTuningApply(t *testing.T) {
+	t.Setenv("PRODUCER_ACKS", "all")
+	t.Setenv("PRODUCER_IDEMPOTENT", "true")
+	t.Setenv("PRODUCER_COMPRESSION", "LZ4")
+	t.Setenv("PRODUCER_FLUSH_MESSAGES", "100")
+	tuning, err := parseProducerTuning()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := sarama.NewConfig()
+	defaults := sarama.NewConfig()
+	tuning.apply(config)
+	if config.Producer.RequiredAcks != sarama.WaitForAll || !config.Producer.Idempotent || config.Net.MaxOpenRequests != 1 {
+		t.Errorf("acks %v, idempotent %v, max open requests %d", config.Producer.RequiredAcks, config.Producer.Idempotent, config.Net.MaxOpenRequests)
+	}
+	if config.Producer.Compression != sarama.CompressionLZ4 || config.Producer.Flush.Messages != 100 {
+		t.Errorf("compression %v, flush messages %d", config.Producer.Compression, config.Producer.Flush.Messages)
+	}
+	if config.Producer.MaxMessageBytes != defaults.Producer.MaxMessageBytes || config.Producer.Flush.Frequency != defaults.Producer.Flush.Frequency {
+		t.Error("settings which are not configured changed")
+	}
+}
+
+func TestAsyncKafkaSink(t *testing.T) {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	asyncProducer := mocks.NewAsyncProducer(t, config)
+	syncProducer := mocks.NewSyncProducer(t, config)
+	sink := newAsyncKafkaSink(asyncProducer, &kafkaSink{producer: syncProducer}, 1000, zap.NewNop())
+
+	// Responses are queued, the errors of failed records are only published once acknowledged
+	asyncProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if msg.Topic != "responses" {
+			return errors.New("response produced to " + msg.Topic)
+		}
+		return nil
+	})
+	syncProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if msg.Topic != "errors" {
+			return errors.New("error produced to " + msg.Topic)
+		}
+		return nil
+	})
+	if err := sink.Publish(context.Background(), common.SinkMessage{Topic: "responses", Body: []byte("response")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Publish(context.Background(), common.SinkMessage{Topic: "errors", Body: []byte("error"), Durable: true}); err != nil {
+		t.Fatal(err)
+	}
+	// Close waits for the queued record and fails the test if an expectation is not met
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsyncKafkaSinkDurableFailure(t *testing.T) {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	syncProducer := mocks.NewSyncProducer(t, config)
+	sink := newAsyncKafkaSink(mocks.NewAsyncProducer(t, config), &kafkaSink{producer: syncProducer}, 1000, zap.NewNop())
+	defer sink.Close()
+
+	syncProducer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+	err := sink.Publish(context.Background(), common.SinkMessage{Topic: "orders.retry.1", Durable: true})
+	if !errors.Is(err, sarama.ErrNotEnoughReplicas) {
+		t.Errorf("error %v, want the failure of the sync producer", err)
+	}
+}
+
+func TestNewKafkaSinkFromURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		env  map[string]string
+		// err is a part of the error expected, the others fail to connect to the broker
+		err string
+	}{
+		{name: "no brokers", url: "kafka://", err: "no brokers"},
+		{name: "sasl without password", url: "kafka://user@127.0.0.1:1?sasl=plaintext", err: "requires username and password"},
+		{name: "invalid sasl", url: "kafka://127.0.0.1:1?sasl=kerberos", err: "incorrect value for sasl"},
+		{name: "invalid version", url: "kafka://127.0.0.1:1?version=latest", err: "invalid version"},
+		{name: "zstd with old version", url: "kafka://127.0.0.1:1?version=2.0.0", env: map[string]string{"PRODUCER_COMPRESSION": "zstd"}, err: "requires KAFKA_VERSION 2.1.0"},
+		{name: "zstd with default version", url: "kafka://127.0.0.1:1", env: map[string]string{"PRODUCER_COMPRESSION": "zstd"}, err: "requires KAFKA_VERSION 2.1.0"},
+		{name: "zstd with version", url: "kafka://127.0.0.1:1?version=3.6.0", env: map[string]string{"PRODUCER_COMPRESSION": "zstd"}},
+		{name: "zstd with KAFKA_VERSION", url: "kafka://127.0.0.1:1", env: map[string]string{"PRODUCER_COMPRESSION": "zstd", "KAFKA_VERSION": "3.6.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"PRODUCER_COMPRESSION", "KAFKA_VERSION"} {
+				t.Setenv(key, tt.env[key])
+			}
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sink, err := newKafkaSinkFromURL(context.Background(), u, common.ConnectorMetadata{}, zap.NewNop())
+			if err == nil {
+				sink.Close()
+				t.Fatal("sink created without a broker")
+			}
+			if tt.err == "" {
+				if !errors.Is(err, sarama.ErrOutOfBrokers) {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error %q does not contain %q", err, tt.err)
+			}
+		})
+	}
+}
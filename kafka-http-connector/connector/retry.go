@@ -0,0 +1,168 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+// Headers of the records produced to retry topics
+const (
+	headerRetryAttempt      = "KEDA-Retry-Attempt"
+	headerRetryDue          = "KEDA-Retry-Due"
+	headerOriginalTopic     = "KEDA-Original-Topic"
+	headerOriginalPartition = "KEDA-Original-Partition"
+	headerOriginalOffset    = "KEDA-Original-Offset"
+)
+
+// retryTopicSuffix matches the retry topics, which are never matched by a topic pattern
+var retryTopicSuffix = regexp.MustCompile(`\.retry\.[0-9]+$`)
+
+// retryTopics produces failed records to <topic>.retry.<n> topics, from which they are
+// consumed again once the delay of the retry topic has elapsed
+type retryTopics struct {
+	delays []time.Duration
+	sink   common.Sink
+}
+
+// parseRetryDelays reads the comma separated delays of the retry topics from RETRY_TOPIC_DELAYS
+func parseRetryDelays() ([]time.Duration, error) {
+	var delays []time.Duration
+	for _, v := range strings.Split(os.Getenv("RETRY_TOPIC_DELAYS"), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		delay, err := time.ParseDuration(v)
+		if err != nil || delay <= 0 {
+			return nil, fmt.Errorf("RETRY_TOPIC_DELAYS must be a comma separated list of positive durations, got %q", v)
+		}
+		delays = append(delays, delay)
+	}
+	return delays, nil
+}
+
+// retryTopic returns the name of the nth retry topic of topic
+func retryTopic(topic string, n int) string {
+	return fmt.Sprintf("%s.retry.%d", topic, n)
+}
+
+// withRetryTopics returns topics with their retry topics
+func withRetryTopics(topics []string, delays []time.Duration) []string {
+	if len(delays) == 0 {
+		return topics
+	}
+	all := make([]string, 0, len(topics)*(len(delays)+1))
+	for _, topic := range topics {
+		all = append(all, topic)
+		for n := range delays {
+			all = append(all, retryTopic(topic, n+1))
+		}
+	}
+	return all
+}
+
+// recordHeader returns the value of the header key of record
+func recordHeader(record *sarama.ConsumerMessage, key string) (string, bool) {
+	for _, h := range record.Headers {
+		if strings.EqualFold(string(h.Key), key) {
+			return string(h.Value), true
+		}
+	}
+	return "", false
+}
+
+// originalTopic returns the topic the record was first consumed from
+func originalTopic(record *sarama.ConsumerMessage) string {
+	if topic, ok := recordHeader(record, headerOriginalTopic); ok {
+		return topic
+	}
+	return record.Topic
+}
+
+// Defer produces the record to the next retry topic. It returns false once the record has
+// been through every retry topic.
+func (m *kafkaMessage) Defer(ctx context.Context, _ error) (bool, error) {
+	if m.retry == nil {
+		return false, nil
+	}
+	attempt := 0
+	if v, ok := recordHeader(m.record, headerRetryAttempt); ok {
+		attempt, _ = strconv.Atoi(v)
+	}
+	if attempt >= len(m.retry.delays) {
+		return false, nil
+	}
+	attempt++
+
+	// The headers of the record are kept, the original coordinates are only set on the
+	// first retry
+	headers := http.Header{}
+	for _, h := range m.record.Headers {
+		key := string(h.Key)
+		if strings.EqualFold(key, headerRetryAttempt) || strings.EqualFold(key, headerRetryDue) {
+			continue
+		}
+		headers[key] = append(headers[key], string(h.Value))
+	}
+	if _, ok := recordHeader(m.record, headerOriginalTopic); !ok {
+		headers[headerOriginalTopic] = []string{m.record.Topic}
+		headers[headerOriginalPartition] = []string{strconv.FormatInt(int64(m.record.Partition), 10)}
+		headers[headerOriginalOffset] = []string{strconv.FormatInt(m.record.Offset, 10)}
+	}
+	due := time.Now().Add(m.retry.delays[attempt-1])
+	headers[headerRetryAttempt] = []string{strconv.Itoa(attempt)}
+	headers[headerRetryDue] = []string{strconv.FormatInt(due.UnixMilli(), 10)}
+
+	err := m.retry.sink.Publish(ctx, common.SinkMessage{
+		Topic:   retryTopic(originalTopic(m.record), attempt),
+		Key:     string(m.record.Key),
+		Body:    m.record.Value,
+		Headers: headers,
+		Durable: true,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to produce record to retry topic: %w", err)
+	}
+	return true, nil
+}
+
+// waitUntilDue blocks until the record of a retry topic is due, it returns false if ctx is
+// done first
+func (conn *kafkaConnector) waitUntilDue(ctx context.Context, message *sarama.ConsumerMessage) bool {
+	v, ok := recordHeader(message, headerRetryDue)
+	if !ok {
+		return true
+	}
+	dueMillis, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return true
+	}
+	wait := time.Until(time.UnixMilli(dueMillis))
+	if wait <= 0 {
+		return true
+	}
+
+	conn.logger.Debug("waiting for retry record to be due",
+		zap.String("topic", message.Topic),
+		zap.Int32("partition", message.Partition),
+		zap.Int64("offset", message.Offset),
+		zap.Duration("wait", wait))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
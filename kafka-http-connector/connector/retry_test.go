@@ -0,0 +1,193 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+)
+
+func TestParseRetryDelays(t *testing.T) {
+	t.Setenv("RETRY_TOPIC_DELAYS", " 10s, 1m ,")
+	delays, err := parseRetryDelays()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(delays, []time.Duration{10 * time.Second, time.Minute}) {
+		t.Errorf("delays %v", delays)
+	}
+	for _, v := range []string{"10s,0s", "-1m", "soon"} {
+		t.Setenv("RETRY_TOPIC_DELAYS", v)
+		if _, err := parseRetryDelays(); err == nil {
+			t.Errorf("RETRY_TOPIC_DELAYS %q accepted", v)
+		}
+	}
+}
+
+func TestWithRetryTopics(t *testing.T) {
+	topics := withRetryTopics([]string{"orders", "payments"}, []time.Duration{time.Second, time.Minute})
+	want := []string{"orders", "orders.retry.1", "orders.retry.2", "payments", "payments.retry.1", "payments.retry.2"}
+	if !slices.Equal(topics, want) {
+		t.Errorf("topics %v, want %v", topics, want)
+	}
+	if topics := withRetryTopics([]string{"orders"}, nil); !slices.Equal(topics, []string{"orders"}) {
+		t.Errorf("topics %v without retry topics", topics)
+	}
+	for _, topic := range want {
+		if retry := retryTopicSuffix.MatchString(topic); retry != (topic != "orders" && topic != "payments") {
+			t.Errorf("topic %s matched as a retry topic %v", topic, retry)
+		}
+	}
+}
+
+// retryRecord returns a record of the nth retry topic of orders
+func retryRecord(n int, due time.Time) *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{
+		Topic:     retryTopic("orders", n),
+		Partition: 0,
+		Offset:    3,
+		Key:       []byte("order-1"),
+		Value:     []byte("order"),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("X-Trace"), Value: []byte("1")},
+			{Key: []byte(headerOriginalTopic), Value: []byte("orders")},
+			{Key: []byte(headerOriginalPartition), Value: []byte("2")},
+			{Key: []byte(headerOriginalOffset), Value: []byte("41")},
+			{Key: []byte(headerRetryAttempt), Value: []byte(strconv.Itoa(n))},
+			{Key: []byte(headerRetryDue), Value: []byte(strconv.FormatInt(due.UnixMilli(), 10))},
+		},
+	}
+}
+
+func TestDefer(t *testing.T) {
+	delays := []time.Duration{time.Minute, time.Hour}
+	tests := []struct {
+		name   string
+		record *sarama.ConsumerMessage
+		// topic is the retry topic the record is produced to, empty if it is not deferred
+		topic   string
+		attempt string
+	}{
+		{
+			name:    "first retry",
+			record:  &sarama.ConsumerMessage{Topic: "orders", Partition: 2, Offset: 41, Key: []byte("order-1"), Value: []byte("order")},
+			topic:   "orders.retry.1",
+			attempt: "1",
+		},
+		{name: "next retry", record: retryRecord(1, time.Now()), topic: "orders.retry.2", attempt: "2"},
+		{name: "retries exhausted", record: retryRecord(2, time.Now())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &publishingSink{}
+			msg := &kafkaMessage{record: tt.record, retry: &retryTopics{delays: delays, sink: sink}}
+			before := time.Now()
+			deferred, err := msg.Defer(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.topic == "" {
+				if deferred || len(sink.msgs) > 0 {
+					t.Errorf("deferred %v, published %v", deferred, sink.topics())
+				}
+				return
+			}
+			if !deferred || len(sink.msgs) != 1 {
+				t.Fatalf("deferred %v, published %v", deferred, sink.topics())
+			}
+			published := sink.msgs[0]
+			if published.Topic != tt.topic || published.Key != "order-1" || string(published.Body) != "order" || !published.Durable {
+				t.Errorf("published %s to %s with key %q, durable %v", published.Body, published.Topic, published.Key, published.Durable)
+			}
+			headers := published.Headers
+			if headers[headerRetryAttempt][0] != tt.attempt || len(headers[headerRetryAttempt]) != 1 {
+				t.Errorf("attempt %v, want %s", headers[headerRetryAttempt], tt.attempt)
+			}
+			if headers[headerOriginalTopic][0] != "orders" || headers[headerOriginalPartition][0] != "2" || headers[headerOriginalOffset][0] != "41" {
+				t.Errorf("original coordinates %v", headers)
+			}
+			attempt, _ := strconv.Atoi(tt.attempt)
+			dueMillis, _ := strconv.ParseInt(headers[headerRetryDue][0], 10, 64)
+			if due := time.UnixMilli(dueMillis); due.Before(before.Add(delays[attempt-1]).Truncate(time.Millisecond)) {
+				t.Errorf("due at %v, want %v after %v", due, delays[attempt-1], before)
+			}
+		})
+	}
+}
+
+func TestDeferWithoutRetryTopics(t *testing.T) {
+	msg := &kafkaMessage{record: &sarama.ConsumerMessage{Topic: "orders"}}
+	if deferred, err := msg.Defer(context.Background(), nil); deferred || err != nil {
+		t.Errorf("deferred %v, %v without RETRY_TOPIC_DELAYS", deferred, err)
+	}
+
+	sink := &publishingSink{failTopic: "orders.retry.1"}
+	msg.retry = &retryTopics{delays: []time.Duration{time.Minute}, sink: sink}
+	if deferred, err := msg.Defer(context.Background(), nil); deferred || err == nil {
+		t.Errorf("deferred %v, %v although producing failed", deferred, err)
+	}
+}
+
+func TestWaitUntilDue(t *testing.T) {
+	conn := &kafkaConnector{logger: zap.NewNop()}
+	tests := []struct {
+		name   string
+		record *sarama.ConsumerMessage
+		// wait is the minimum time waited
+		wait    time.Duration
+		timeout time.Duration
+		due     bool
+	}{
+		{name: "not a retry record", record: &sarama.ConsumerMessage{Topic: "orders"}, timeout: time.Second, due: true},
+		{name: "already due", record: retryRecord(1, time.Now().Add(-time.Minute)), timeout: time.Second, due: true},
+		{name: "due soon", record: retryRecord(1, time.Now().Add(50*time.Millisecond)), wait: 40 * time.Millisecond, timeout: time.Second, due: true},
+		{name: "revoked before due", record: retryRecord(1, time.Now().Add(time.Hour)), timeout: 20 * time.Millisecond},
+		{
+			name:    "invalid due time",
+			record:  &sarama.ConsumerMessage{Headers: []*sarama.RecordHeader{{Key: []byte(headerRetryDue), Value: []byte("soon")}}},
+			timeout: time.Second,
+			due:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			start := time.Now()
+			if due := conn.waitUntilDue(ctx, tt.record); due != tt.due {
+				t.Errorf("due %v, want %v", due, tt.due)
+			}
+			if waited := time.Since(start); waited < tt.wait {
+				t.Errorf("waited %v, want at least %v", waited, tt.wait)
+			}
+		})
+	}
+}
+
+func TestHandleRetryTopic(t *testing.T) {
+	sink := &publishingSink{}
+	conn, pipeline := newTestConnector(t, functionServer(t, http.StatusServiceUnavailable, "unavailable"), sink)
+	pipeline.AckAfterError = true
+	conn.retry = &retryTopics{delays: []time.Duration{time.Minute}, sink: sink}
+	session := &markingSession{}
+
+	// A failed record is produced to the retry topic and its offset committed
+	if !conn.handle(context.Background(), session, &sarama.ConsumerMessage{Topic: "orders", Offset: 41, Value: []byte("order")}, nil, nil) {
+		t.Fatal("deferred record not acknowledged")
+	}
+	// Once it has been through every retry topic, its error is published
+	if !conn.handle(context.Background(), session, retryRecord(1, time.Now()), nil, nil) {
+		t.Fatal("record not acknowledged after its last retry")
+	}
+	if topics := sink.topics(); !slices.Equal(topics, []string{"orders.retry.1", "errors"}) {
+		t.Errorf("published to %v", topics)
+	}
+	if !slices.Equal(session.marked, []int64{42, 4}) {
+		t.Errorf("marked offsets %v", session.marked)
+	}
+}
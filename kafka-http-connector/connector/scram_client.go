@@ -6,7 +6,7 @@
 
 // https://github.com/kedacore/keda/blob/master/pkg/scalers/kafka_scram_client.go
 
-package main
+package connector
 
 import (
 	"crypto/sha256"
@@ -0,0 +1,208 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+func init() {
+	common.RegisterSink("kafka", newKafkaSinkFromURL)
+}
+
+// kafkaSink publishes messages with a Sarama sync producer
+type kafkaSink struct {
+	producer        sarama.SyncProducer
+	maxMessageBytes int
+}
+
+// newKafkaSinkFromURL creates a sink from a URL of the form
+// kafka://[username:password@]broker1:9092,broker2:9092[?sasl=scram_sha512&tls=enable&version=3.6.0]
+func newKafkaSinkFromURL(ctx context.Context, u *url.URL, _ common.ConnectorMetadata, logger *zap.Logger) (common.Sink, error) {
+	if u.Host == "" {
+		return nil, errors.New("no brokers given in kafka sink url")
+	}
+
+	query := u.Query()
+	metadata := kafkaMetadata{
+		bootstrapServers: strings.Split(u.Host, ","),
+		saslType:         query.Get("sasl"),
+		tls:              query.Get("tls"),
+	}
+	if u.User != nil {
+		metadata.username = u.User.Username()
+		metadata.password, _ = u.User.Password()
+	}
+	switch metadata.saslType {
+	case kafkaAuthModeNone:
+	case kafkaAuthModeSaslPlaintext, kafkaAuthModeSaslScramSha256, kafkaAuthModeSaslScramSha512:
+		if metadata.username == "" || metadata.password == "" {
+			return nil, errors.New("kafka sink url with sasl requires username and password")
+		}
+	case kafkaAuthModeSaslOAuthBearer:
+		// The client credentials are read from the OAUTH_* environment variables
+		provider, err := newOAuthTokenProviderFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		metadata.tokenProvider = provider
+	case kafkaAuthModeSaslAWSMSKIAM:
+		provider, err := newMSKIAMTokenProvider(ctx)
+		if err != nil {
+			return nil, err
+		}
+		metadata.tokenProvider = provider
+	default:
+		return nil, fmt.Errorf("incorrect value for sasl authentication %s given in kafka sink url", metadata.saslType)
+	}
+
+	// The version defaults to KAFKA_VERSION, the cluster of the sink is usually the one
+	// records are consumed from
+	version := query.Get("version")
+	if version == "" {
+		version = os.Getenv("KAFKA_VERSION")
+	}
+	var err error
+	if metadata.tuning.version, err = parseKafkaVersion(version); err != nil {
+		return nil, fmt.Errorf("invalid version in kafka sink url: %w", err)
+	}
+
+	// The producer settings are read from the PRODUCER_* environment variables
+	metadata.producer, err = parseProducerTuning()
+	if err != nil {
+		return nil, err
+	}
+	if err := metadata.producer.check(kafkaVersion(metadata)); err != nil {
+		return nil, err
+	}
+	return newKafkaSink(metadata, logger)
+}
+
+func (s *kafkaSink) Publish(_ context.Context, msg common.SinkMessage) error {
+	_, _, err := s.producer.SendMessage(producerMessage(msg))
+	return err
+}
+
+func (s *kafkaSink) MaxMessageSize() int {
+	return s.maxMessageBytes
+}
+
+// Size counts the value, key and headers of the record
+func (s *kafkaSink) Size(msg common.SinkMessage) int {
+	return msg.Size()
+}
+
+func (s *kafkaSink) Close() error {
+	return s.producer.Close()
+}
+
+// producerMessage converts msg to a Kafka record
+func producerMessage(msg common.SinkMessage) *sarama.ProducerMessage {
+	record := &sarama.ProducerMessage{
+		Topic:   msg.Topic,
+		Value:   sarama.ByteEncoder(msg.Body),
+		Headers: recordHeaders(msg.Headers),
+	}
+	if msg.Key != "" {
+		record.Key = sarama.StringEncoder(msg.Key)
+	}
+	return record
+}
+
+// recordHeaders converts HTTP headers to Kafka record headers
+func recordHeaders(headers http.Header) []sarama.RecordHeader {
+	var kafkaRecordHeaders []sarama.RecordHeader
+	for k, v := range headers {
+		// One key may have multiple values
+		for _, v := range v {
+			kafkaRecordHeaders = append(kafkaRecordHeaders, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+		}
+	}
+	return kafkaRecordHeaders
+}
+
+// transactionalBatchSink publishes the parts of split responses in a Kafka transaction, so
+// that consumers reading with read_committed isolation see either all of them or none. Single
+// messages are published by the wrapped sink.
+type transactionalBatchSink struct {
+	common.SizeLimitedSink
+	// producer is transactional, its transactions are run one at a time
+	producer sarama.SyncProducer
+	mu       sync.Mutex
+}
+
+// batchProducers numbers the transactional producers of the process, so that each of them has
+// its own transactional id. The id is only the same after a restart when the hostname is, e.g.
+// for the pods of a StatefulSet. A connector restarted with another hostname does not fence
+// the producer it replaces, whose open transaction is aborted by the broker once it times out.
+var batchProducers atomic.Int32
+
+func newTransactionalBatchSink(metadata kafkaMetadata, sink common.SizeLimitedSink) (*transactionalBatchSink, error) {
+	config, err := getProducerConfig(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := metadata.transactionalIDPrefix
+	if prefix == "" {
+		prefix = os.Getenv("TRANSACTIONAL_ID_PREFIX")
+	}
+	if prefix == "" {
+		prefix = "keda-connector"
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname for transactional id: %w", err)
+	}
+
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Transaction.ID = fmt.Sprintf("%s-%s-%d", prefix, hostname, batchProducers.Add(1))
+	config.Net.MaxOpenRequests = 1
+	producer, err := sarama.NewSyncProducer(metadata.bootstrapServers, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transactional producer: %w", err)
+	}
+	return &transactionalBatchSink{SizeLimitedSink: sink, producer: producer}, nil
+}
+
+func (s *transactionalBatchSink) PublishBatch(_ context.Context, msgs []common.SinkMessage) error {
+	records := make([]*sarama.ProducerMessage, len(msgs))
+	for i, msg := range msgs {
+		records[i] = producerMessage(msg)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.producer.BeginTxn(); err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := s.producer.SendMessages(records); err != nil {
+		abortTransaction(s.producer)
+		return err
+	}
+	if err := s.producer.CommitTxn(); err != nil {
+		abortTransaction(s.producer)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (s *transactionalBatchSink) Close() error {
+	err := s.producer.Close()
+	if sinkErr := s.SizeLimitedSink.Close(); err == nil {
+		err = sinkErr
+	}
+	return err
+}
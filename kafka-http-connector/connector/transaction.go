@@ -0,0 +1,134 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+type transactionKey struct{}
+
+// recordTransaction is the Kafka transaction in which a record is processed in exactly-once
+// mode. The response or error records and the offset of the record are committed together.
+type recordTransaction struct {
+	producer sarama.SyncProducer
+	group    string
+	// failed is set when the transaction was aborted and the record has to be processed again
+	failed bool
+}
+
+// transactionalSink publishes messages in the transaction of the record being processed, so
+// split responses are published atomically as well
+type transactionalSink struct{}
+
+func (transactionalSink) Publish(ctx context.Context, msg common.SinkMessage) error {
+	txn, ok := ctx.Value(transactionKey{}).(*recordTransaction)
+	if !ok {
+		return errors.New("no kafka transaction to publish in")
+	}
+	_, _, err := txn.producer.SendMessage(producerMessage(msg))
+	return err
+}
+
+func (s transactionalSink) PublishBatch(ctx context.Context, msgs []common.SinkMessage) error {
+	for _, msg := range msgs {
+		if err := s.Publish(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (transactionalSink) Close() error {
+	return nil
+}
+
+// commit adds the offset of record to the transaction and commits it
+func (txn *recordTransaction) commit(record *sarama.ConsumerMessage) error {
+	if err := txn.producer.AddMessageToTxn(record, txn.group, nil); err != nil {
+		txn.abort()
+		return fmt.Errorf("failed to add offset to transaction: %w", err)
+	}
+	if err := txn.producer.CommitTxn(); err != nil {
+		txn.abort()
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// abort aborts the transaction, the record is consumed again once the session is restarted
+func (txn *recordTransaction) abort() {
+	txn.failed = true
+	abortTransaction(txn.producer)
+}
+
+// abortTransaction aborts the current transaction of producer unless it is in a fatal state,
+// in which case it cannot be used anymore
+func abortTransaction(producer sarama.SyncProducer) {
+	if producer.TxnStatus()&sarama.ProducerTxnFlagFatalError == 0 {
+		_ = producer.AbortTxn()
+	}
+}
+
+// getTransactionalProducer creates the producer of a partition, every partition has its own
+// transactional id so that a producer taking over the partition after a rebalance fences the
+// previous one
+func getTransactionalProducer(metadata kafkaMetadata, topic string, partition int32) (sarama.SyncProducer, error) {
+	config, err := getConfig(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the batching and compression settings apply, the transactional producer always
+	// waits for every replica
+	metadata.producer.apply(config)
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 10
+	config.Producer.Return.Successes = true
+	config.Producer.Transaction.ID = fmt.Sprintf("%s-%s-%d", metadata.transactionalIDPrefix, topic, partition)
+	config.Net.MaxOpenRequests = 1
+	return sarama.NewSyncProducer(metadata.bootstrapServers, config)
+}
+
+// consumeTransactionally processes every record of claim in its own transaction. When a
+// transaction fails the session is restarted, so that the partition is consumed again from
+// the last committed offset.
+func (conn *kafkaConnector) consumeTransactionally(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) {
+	producer, err := getTransactionalProducer(conn.metadata, claim.Topic(), claim.Partition())
+	if err != nil {
+		conn.logger.Error("failed to create transactional producer",
+			zap.Error(err),
+			zap.String("topic", claim.Topic()),
+			zap.Int32("partition", claim.Partition()))
+		conn.restartSession()
+		return
+	}
+	defer producer.Close()
+
+	for message := range claim.Messages() {
+		if !conn.waitUntilDue(session.Context(), message) {
+			return
+		}
+		if err := producer.BeginTxn(); err != nil {
+			conn.logger.Error("failed to begin transaction", zap.Error(err))
+			conn.restartSession()
+			return
+		}
+		txn := &recordTransaction{producer: producer, group: conn.metadata.consumerGroup}
+		conn.handle(context.WithValue(session.Context(), transactionKey{}, txn), session, message, nil, txn)
+		if txn.failed {
+			conn.logger.Warn("transaction aborted, consuming the partition again from the last committed offset",
+				zap.String("topic", message.Topic),
+				zap.Int32("partition", message.Partition),
+				zap.Int64("offset", message.Offset))
+			conn.restartSession()
+			return
+		}
+	}
+}
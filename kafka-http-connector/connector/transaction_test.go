@@ -0,0 +1,149 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/IBM/sarama"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+var errTestCommit = errors.New("commit failed")
+
+// txnProducer records the transaction calls of a transactional producer
+type txnProducer struct {
+	sarama.SyncProducer
+	sendFails bool
+	commitErr error
+	status    sarama.ProducerTxnStatusFlag
+
+	sent    []*sarama.ProducerMessage
+	offsets []int64
+	commits int
+	aborts  int
+}
+
+func (p *txnProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	if p.sendFails {
+		return 0, 0, errTestCommit
+	}
+	p.sent = append(p.sent, msg)
+	return 0, int64(len(p.sent)), nil
+}
+
+func (p *txnProducer) AddMessageToTxn(msg *sarama.ConsumerMessage, _ string, _ *string) error {
+	p.offsets = append(p.offsets, msg.Offset)
+	return nil
+}
+
+func (p *txnProducer) CommitTxn() error {
+	if p.commitErr != nil {
+		return p.commitErr
+	}
+	p.commits++
+	return nil
+}
+
+func (p *txnProducer) AbortTxn() error {
+	p.aborts++
+	p.sent = nil
+	return nil
+}
+
+func (p *txnProducer) TxnStatus() sarama.ProducerTxnStatusFlag { return p.status }
+
+func TestTransactionalSink(t *testing.T) {
+	producer := &txnProducer{}
+	txn := &recordTransaction{producer: producer, group: "group"}
+	ctx := context.WithValue(context.Background(), transactionKey{}, txn)
+
+	msgs := []common.SinkMessage{{Topic: "responses", Body: []byte("part 1")}, {Topic: "responses", Body: []byte("part 2"), Key: "key"}}
+	if err := (transactionalSink{}).PublishBatch(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(producer.sent) != 2 || producer.sent[1].Topic != "responses" || producer.sent[1].Key != sarama.StringEncoder("key") {
+		t.Errorf("sent %v", producer.sent)
+	}
+
+	if err := (transactionalSink{}).Publish(context.Background(), msgs[0]); err == nil {
+		t.Error("message published outside of a transaction")
+	}
+}
+
+func TestRecordTransactionCommit(t *testing.T) {
+	tests := []struct {
+		name      string
+		commitErr error
+		status    sarama.ProducerTxnStatusFlag
+		aborts    int
+	}{
+		{name: "committed"},
+		{name: "commit failed", commitErr: errTestCommit, status: sarama.ProducerTxnFlagInTransaction, aborts: 1},
+		// A producer in a fatal state cannot abort, the session is restarted with a new one
+		{name: "fatal error", commitErr: errTestCommit, status: sarama.ProducerTxnFlagFatalError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := &txnProducer{commitErr: tt.commitErr, status: tt.status}
+			txn := &recordTransaction{producer: producer, group: "group"}
+			err := txn.commit(&sarama.ConsumerMessage{Topic: "orders", Offset: 42})
+			if tt.commitErr != nil {
+				if !errors.Is(err, tt.commitErr) || !txn.failed {
+					t.Errorf("error %v, failed %v", err, txn.failed)
+				}
+			} else if err != nil || producer.commits != 1 || txn.failed {
+				t.Errorf("error %v, %d commits", err, producer.commits)
+			}
+			if len(producer.offsets) != 1 || producer.offsets[0] != 42 {
+				t.Errorf("offsets %v added to the transaction", producer.offsets)
+			}
+			if producer.aborts != tt.aborts {
+				t.Errorf("%d aborts, want %d", producer.aborts, tt.aborts)
+			}
+		})
+	}
+}
+
+func TestHandleTransactionally(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		sendFails bool
+		// topic is the topic of the record committed with the offset, empty if the
+		// transaction is aborted
+		topic string
+	}{
+		{name: "response committed", status: http.StatusOK, topic: "responses"},
+		{name: "error committed", status: http.StatusInternalServerError, topic: "errors"},
+		{name: "response not published", status: http.StatusOK, sendFails: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, pipeline := newTestConnector(t, functionServer(t, tt.status, "response"), transactionalSink{})
+			pipeline.AckAfterError = true
+			producer := &txnProducer{sendFails: tt.sendFails}
+			txn := &recordTransaction{producer: producer, group: "group"}
+			record := &sarama.ConsumerMessage{Topic: "orders", Offset: 7, Value: []byte("order")}
+
+			acked := conn.handle(context.WithValue(context.Background(), transactionKey{}, txn), nil, record, nil, txn)
+			if tt.topic == "" {
+				if acked || !txn.failed || producer.aborts != 1 || producer.commits != 0 {
+					t.Errorf("acked %v, failed %v, %d aborts, %d commits", acked, txn.failed, producer.aborts, producer.commits)
+				}
+				return
+			}
+			if !acked || txn.failed || producer.commits != 1 {
+				t.Fatalf("acked %v, failed %v, %d commits", acked, txn.failed, producer.commits)
+			}
+			if len(producer.sent) != 1 || producer.sent[0].Topic != tt.topic {
+				t.Errorf("sent %v, want one record to %s", producer.sent, tt.topic)
+			}
+			if len(producer.offsets) != 1 || producer.offsets[0] != 7 {
+				t.Errorf("offsets %v committed, want 7", producer.offsets)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package connector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	rebalanceStrategyRange             = "range"
+	rebalanceStrategyRoundRobin        = "roundrobin"
+	rebalanceStrategySticky            = "sticky"
+	rebalanceStrategyCooperativeSticky = "cooperative-sticky"
+)
+
+// consumerTuning holds the optional settings of the consumer, zero values keep the defaults
+// of Sarama
+type consumerTuning struct {
+	// version is the protocol version, auto selects the highest version supported by Sarama
+	// and lets every request be negotiated with the broker
+	version           sarama.KafkaVersion
+	rebalanceStrategy string
+	sessionTimeout    time.Duration
+	heartbeatInterval time.Duration
+	maxProcessingTime time.Duration
+	fetchMin          int32
+	fetchDefault      int32
+	fetchMax          int32
+	channelBufferSize int
+}
+
+// parseKafkaVersion parses a Kafka version, auto selects the highest version supported by
+// Sarama and an empty version keeps the default
+func parseKafkaVersion(v string) (sarama.KafkaVersion, error) {
+	switch v {
+	case "":
+		return sarama.KafkaVersion{}, nil
+	case "auto":
+		return sarama.MaxVersion, nil
+	}
+	version, err := sarama.ParseKafkaVersion(v)
+	if err != nil {
+		return version, fmt.Errorf("%q must be auto or a version such as 3.6.0", v)
+	}
+	return version, nil
+}
+
+// parseConsumerTuning reads the consumer settings from the environment
+func parseConsumerTuning() (consumerTuning, error) {
+	tuning := consumerTuning{}
+
+	version, err := parseKafkaVersion(os.Getenv("KAFKA_VERSION"))
+	if err != nil {
+		return tuning, fmt.Errorf("invalid KAFKA_VERSION: %w", err)
+	}
+	tuning.version = version
+
+	switch v := strings.ToLower(os.Getenv("REBALANCE_STRATEGY")); v {
+	case "", rebalanceStrategyRange, rebalanceStrategyRoundRobin, rebalanceStrategySticky:
+		tuning.rebalanceStrategy = v
+	case rebalanceStrategyCooperativeSticky:
+		return tuning, errors.New("REBALANCE_STRATEGY cooperative-sticky is not supported by the Kafka client, use sticky instead")
+	default:
+		return tuning, fmt.Errorf("invalid REBALANCE_STRATEGY %q, must be one of range, roundrobin or sticky", v)
+	}
+
+	if tuning.sessionTimeout, err = envDuration("SESSION_TIMEOUT"); err != nil {
+		return tuning, err
+	}
+	if tuning.heartbeatInterval, err = envDuration("HEARTBEAT_INTERVAL"); err != nil {
+		return tuning, err
+	}
+	if tuning.maxProcessingTime, err = envDuration("MAX_PROCESSING_TIME"); err != nil {
+		return tuning, err
+	}
+	sessionTimeout, heartbeatInterval := tuning.sessionTimeout, tuning.heartbeatInterval
+	if sessionTimeout == 0 {
+		sessionTimeout = 10 * time.Second
+	}
+	if heartbeatInterval == 0 {
+		heartbeatInterval = 3 * time.Second
+	}
+	if heartbeatInterval >= sessionTimeout {
+		return tuning, fmt.Errorf("HEARTBEAT_INTERVAL %v must be lower than SESSION_TIMEOUT %v", heartbeatInterval, sessionTimeout)
+	}
+
+	if tuning.fetchMin, err = envInt32("FETCH_MIN_BYTES"); err != nil {
+		return tuning, err
+	}
+	if tuning.fetchDefault, err = envInt32("FETCH_DEFAULT_BYTES"); err != nil {
+		return tuning, err
+	}
+	if tuning.fetchMax, err = envInt32("FETCH_MAX_BYTES"); err != nil {
+		return tuning, err
+	}
+	if tuning.fetchMin > 0 && tuning.fetchDefault > 0 && tuning.fetchMin > tuning.fetchDefault {
+		return tuning, errors.New("FETCH_MIN_BYTES must not be greater than FETCH_DEFAULT_BYTES")
+	}
+	if tuning.fetchMax > 0 && tuning.fetchDefault > tuning.fetchMax {
+		return tuning, errors.New("FETCH_DEFAULT_BYTES must not be greater than FETCH_MAX_BYTES")
+	}
+
+	if v := os.Getenv("CHANNEL_BUFFER_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			return tuning, fmt.Errorf("CHANNEL_BUFFER_SIZE must be a positive number, got %q", v)
+		}
+		tuning.channelBufferSize = size
+	}
+	return tuning, nil
+}
+
+// apply sets the configured settings on config
+func (t consumerTuning) apply(config *sarama.Config) {
+	if t.version != (sarama.KafkaVersion{}) {
+		config.Version = t.version
+	}
+	switch t.rebalanceStrategy {
+	case rebalanceStrategyRange:
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRange()}
+	case rebalanceStrategyRoundRobin:
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
+	case rebalanceStrategySticky:
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategySticky()}
+	}
+	if t.sessionTimeout > 0 {
+		config.Consumer.Group.Session.Timeout = t.sessionTimeout
+	}
+	if t.heartbeatInterval > 0 {
+		config.Consumer.Group.Heartbeat.Interval = t.heartbeatInterval
+	}
+	if t.maxProcessingTime > 0 {
+		config.Consumer.MaxProcessingTime = t.maxProcessingTime
+	}
+	if t.fetchMin > 0 {
+		config.Consumer.Fetch.Min = t.fetchMin
+	}
+	if t.fetchDefault > 0 {
+		config.Consumer.Fetch.Default = t.fetchDefault
+	}
+	if t.fetchMax > 0 {
+		config.Consumer.Fetch.Max = t.fetchMax
+	}
+	if t.channelBufferSize > 0 {
+		config.ChannelBufferSize = t.channelBufferSize
+	}
+}
+
+func envDuration(name string) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration, got %q", name, v)
+	}
+	return d, nil
+}
+
+func envInt32(name string) (int32, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 32)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number of bytes, got %q", name, v)
+	}
+	return int32(n), nil
+}
@@ -0,0 +1,107 @@
+package connector
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// workerQueueSize is the number of records queued for each worker of a partition
+const workerQueueSize = 16
+
+// offsetTracker marks the offset of a partition up to the first record which has not been
+// completed yet, so that records processed out of order are never skipped on a restart
+type offsetTracker struct {
+	session   sarama.ConsumerGroupSession
+	topic     string
+	partition int32
+
+	mu sync.Mutex
+	// pending holds the offsets dispatched and not marked yet, in increasing order
+	pending []int64
+	done    map[int64]bool
+}
+
+func newOffsetTracker(session sarama.ConsumerGroupSession, topic string, partition int32) *offsetTracker {
+	return &offsetTracker{
+		session:   session,
+		topic:     topic,
+		partition: partition,
+		done:      map[int64]bool{},
+	}
+}
+
+// add records that the record at offset has been dispatched
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = append(t.pending, offset)
+}
+
+// complete records that the record at offset has been processed and marks the offset after
+// the last record of the contiguous run of completed records
+func (t *offsetTracker) complete(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done[offset] = true
+
+	n := 0
+	for n < len(t.pending) && t.done[t.pending[n]] {
+		delete(t.done, t.pending[n])
+		n++
+	}
+	if n > 0 {
+		t.session.MarkOffset(t.topic, t.partition, t.pending[n-1]+1, "")
+		t.pending = t.pending[n:]
+	}
+}
+
+// consumeConcurrently processes the records of claim with conn.metadata.partitionWorkers
+// workers. Records with the same key are processed by the same worker, in order, records
+// without a key are spread across the workers.
+func (conn *kafkaConnector) consumeConcurrently(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) {
+	tracker := newOffsetTracker(session, claim.Topic(), claim.Partition())
+
+	var wg sync.WaitGroup
+	queues := make([]chan *sarama.ConsumerMessage, conn.metadata.partitionWorkers)
+	for i := range queues {
+		queues[i] = make(chan *sarama.ConsumerMessage, workerQueueSize)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for message := range queues[i] {
+				if !conn.process(session.Context(), session, message, tracker) {
+					// The partition was stopped, the records queued are left unprocessed
+					return
+				}
+			}
+		}()
+	}
+
+	for message := range claim.Messages() {
+		tracker.add(message.Offset)
+		select {
+		case queues[worker(message, len(queues))] <- message:
+		case <-session.Context().Done():
+			// A worker retrying or stopped does not take records anymore
+		}
+	}
+
+	// Let the workers finish the queued records so that their offsets are marked before the
+	// partition is released
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+}
+
+// worker returns the index of the worker processing message
+func worker(message *sarama.ConsumerMessage, workers int) int {
+	if len(message.Key) == 0 {
+		return int(message.Offset % int64(workers))
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(message.Key)
+	return int(h.Sum32() % uint32(workers))
+}
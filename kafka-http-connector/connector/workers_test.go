@@ -0,0 +1,98 @@
+package connector
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+// markingSession records the offsets marked on a consumer group session
+type markingSession struct {
+	sarama.ConsumerGroupSession
+	marked []int64
+}
+
+func (s *markingSession) MarkOffset(_ string, _ int32, offset int64, _ string) {
+	s.marked = append(s.marked, offset)
+}
+
+func (s *markingSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+func TestOffsetTrackerComplete(t *testing.T) {
+	tests := []struct {
+		name       string
+		dispatched []int64
+		completed  []int64
+		marked     []int64
+	}{
+		{
+			name:       "in order",
+			dispatched: []int64{10, 11, 12},
+			completed:  []int64{10, 11, 12},
+			marked:     []int64{11, 12, 13},
+		},
+		{
+			name:       "out of order waits for the lowest offset",
+			dispatched: []int64{10, 11, 12},
+			completed:  []int64{12, 11, 10},
+			marked:     []int64{13},
+		},
+		{
+			name:       "gap is not skipped",
+			dispatched: []int64{10, 11, 12, 13},
+			completed:  []int64{10, 12, 13},
+			marked:     []int64{11},
+		},
+		{
+			name:       "gap filled later",
+			dispatched: []int64{10, 11, 12, 13},
+			completed:  []int64{11, 13, 10, 12},
+			marked:     []int64{12, 14},
+		},
+		{
+			name:       "offsets need not be contiguous",
+			dispatched: []int64{5, 9, 20},
+			completed:  []int64{9, 5, 20},
+			marked:     []int64{10, 21},
+		},
+		{
+			name:       "nothing completed",
+			dispatched: []int64{10, 11},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := &markingSession{}
+			tracker := newOffsetTracker(session, "topic", 0)
+			for _, offset := range tt.dispatched {
+				tracker.add(offset)
+			}
+			for _, offset := range tt.completed {
+				tracker.complete(offset)
+			}
+			if !slices.Equal(session.marked, tt.marked) {
+				t.Errorf("marked offsets %v, want %v", session.marked, tt.marked)
+			}
+		})
+	}
+}
+
+func TestWorker(t *testing.T) {
+	record := func(key string, offset int64) *sarama.ConsumerMessage {
+		return &sarama.ConsumerMessage{Key: []byte(key), Offset: offset}
+	}
+	// Records with the same key go to the same worker whatever their offset
+	for _, key := range []string{"a", "order-1", "order-2"} {
+		if w1, w2 := worker(record(key, 1), 4), worker(record(key, 100), 4); w1 != w2 {
+			t.Errorf("key %q processed by workers %d and %d", key, w1, w2)
+		}
+	}
+	for offset := int64(0); offset < 100; offset++ {
+		if w := worker(record("", offset), 4); w < 0 || w >= 4 {
+			t.Fatalf("record without key at offset %d processed by worker %d of 4", offset, w)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	kinesis "github.com/fission/keda-connectors/aws-kinesis-http-connector/connector"
+	sqs "github.com/fission/keda-connectors/aws-sqs-http-connector/connector"
+	"github.com/fission/keda-connectors/common"
+	pubsub "github.com/fission/keda-connectors/gcp-pubsub-http-connector/connector"
+	kafka "github.com/fission/keda-connectors/kafka-http-connector/connector"
+	jetstream "github.com/fission/keda-connectors/nats-jetstream-http-connector/connector"
+	natsstreaming "github.com/fission/keda-connectors/nats-streaming-http-connector/connector"
+	rabbitmq "github.com/fission/keda-connectors/rabbitmq-http-connector/connector"
+	redis "github.com/fission/keda-connectors/redis-http-connector/connector"
+)
+
+func main() {
+	common.Execute("keda-connector",
+		kafka.Command,
+		sqs.Command,
+		kinesis.Command,
+		rabbitmq.Command,
+		redis.Command,
+		natsstreaming.Command,
+		jetstream.Command,
+		pubsub.Command,
+	)
+}
@@ -0,0 +1,284 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+type jetstreamConnector struct {
+	host            string
+	fissionConsumer string
+	connectordata   common.ConnectorMetadata
+	jsContext       nats.JetStreamContext
+	logger          *zap.Logger
+	consumer        string
+	nc              *nats.Conn
+	ackwait         string
+	concurrentSem   chan int
+
+	mu        sync.Mutex
+	sub       *nats.Subscription
+	subscribe func() (*nats.Subscription, error)
+}
+
+// Command runs the NATS JetStream connector
+var Command = common.Command{
+	Name:        "nats-jetstream",
+	Description: "Consume messages from a NATS JetStream durable consumer and post them to an HTTP endpoint",
+	Run:         Run,
+	Headers:     subjectHeaders,
+}
+
+// Run consumes messages from the configured subject until ctx is cancelled
+func Run(ctx context.Context, logger *zap.Logger, connectordata common.ConnectorMetadata) error {
+	host := os.Getenv("NATS_SERVER")
+	consumer := os.Getenv("CONSUMER")
+	ackwait := os.Getenv("ACKWAIT")
+
+	nc, err := nats.Connect(host)
+	if err != nil {
+		return fmt.Errorf("error while connecting to NATS: %w", err)
+	}
+	defer nc.Close()
+
+	js, err := nc.JetStream()
+	if err != nil {
+		return fmt.Errorf("error while getting jetstream context: %w", err)
+	}
+
+	conn := &jetstreamConnector{
+		host:            host,
+		fissionConsumer: consumer,
+		connectordata:   connectordata,
+		jsContext:       js,
+		logger:          logger,
+		consumer:        consumer,
+		nc:              nc,
+		ackwait:         ackwait,
+		concurrentSem:   initialiseConcurrency(),
+	}
+
+	pipeline, err := common.NewPipeline(ctx, logger, connectordata, &jetstreamSink{jsContext: js})
+	if err != nil {
+		return err
+	}
+	defer pipeline.Close()
+	// Messages are acknowledged once their failure has been published to the error topic
+	pipeline.AckAfterError = true
+
+	common.RegisterPausable(conn)
+	err = conn.Consume(ctx, pipeline.Handle)
+	if err != nil {
+		return fmt.Errorf("error occurred while consuming messages: %w", err)
+	}
+	return nil
+}
+
+func initialiseConcurrency() chan int {
+	concurrent := os.Getenv("CONCURRENT")
+	concurrency := 1
+	if concurrent != "" {
+		var err error
+		concurrency, err = strconv.Atoi(concurrent)
+		if err != nil {
+			concurrency = 1
+		}
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return make(chan int, concurrency)
+}
+
+func (conn *jetstreamConnector) getAckwait() (time.Duration, error) {
+	ackwait := 30 * time.Second
+	if conn.ackwait != "" {
+		var err error
+		ackwait, err = time.ParseDuration(conn.ackwait)
+		if err != nil {
+			conn.logger.Debug("error occurred while parsing ackwait", zap.Error(err))
+			return ackwait, err
+		}
+	}
+	return ackwait, nil
+}
+
+// jetstreamMessage is a message delivered to the durable consumer
+type jetstreamMessage struct {
+	msg     *nats.Msg
+	headers http.Header
+	nc      *nats.Conn
+}
+
+// Headers of JetStream messages carrying the reply address in RPC mode. The reply subject
+// of messages delivered by JetStream is the ack subject, so the sender sets the reply
+// subject as a header instead.
+const (
+	replyToHeader       = "KEDA-Reply-To"
+	correlationIDHeader = "KEDA-Correlation-Id"
+)
+
+func (m *jetstreamMessage) Body() []byte         { return m.msg.Data }
+func (m *jetstreamMessage) Headers() http.Header { return m.headers }
+func (m *jetstreamMessage) Key() string          { return "" }
+
+// Position returns the subject, stream and stream sequence of the message
+func (m *jetstreamMessage) Position() map[string]string {
+	position := map[string]string{"subject": m.msg.Subject}
+	if meta, err := m.msg.Metadata(); err == nil {
+		position["stream"] = meta.Stream
+		position["consumer"] = meta.Consumer
+		position["sequence"] = strconv.FormatUint(meta.Sequence.Stream, 10)
+	}
+	return position
+}
+
+// ReplyTo returns the subject set by the sender in the KEDA-Reply-To header
+func (m *jetstreamMessage) ReplyTo() string {
+	return m.msg.Header.Get(replyToHeader)
+}
+
+// Reply publishes body to the reply subject with the correlation id of the message
+func (m *jetstreamMessage) Reply(ctx context.Context, body []byte, headers http.Header) error {
+	reply := nats.NewMsg(m.ReplyTo())
+	reply.Data = body
+	for k, v := range headers {
+		reply.Header[k] = v
+	}
+	if id := m.msg.Header.Get(correlationIDHeader); id != "" {
+		reply.Header.Set(correlationIDHeader, id)
+	}
+	return m.nc.PublishMsg(reply)
+}
+
+// Ack acknowledges the message
+func (m *jetstreamMessage) Ack() error {
+	return m.msg.Ack()
+}
+
+// Nack leaves the message unacknowledged, the server redelivers it once the ack wait expires
+func (m *jetstreamMessage) Nack() error {
+	return nil
+}
+
+// Consume subscribes to the subject with the durable consumer until ctx is cancelled
+func (conn *jetstreamConnector) Consume(ctx context.Context, handler common.MessageHandler) error {
+	// Establish ackwait
+	ackwait, err := conn.getAckwait()
+	if err != nil {
+		return err
+	}
+
+	// The consumer has to exist before subscribing, otherwise unsubscribing on pause
+	// deletes the consumer created by the subscription along with its position
+	if err := conn.ensureConsumer(ackwait); err != nil {
+		return err
+	}
+
+	headers := subjectHeaders(conn.connectordata)
+
+	conn.subscribe = func() (*nats.Subscription, error) {
+		// Create durable consumer monitor
+		return conn.jsContext.Subscribe(conn.connectordata.Topic, func(msg *nats.Msg) {
+			conn.concurrentSem <- 1
+			go func() {
+				msgHeaders := headers.Clone()
+				maps.Copy(msgHeaders, http.Header(msg.Header)) // Add and overwrite headers from Jetstream
+				handler(ctx, &jetstreamMessage{msg: msg, headers: msgHeaders, nc: conn.nc})
+				<-conn.concurrentSem
+			}()
+			// Durable is required because if we allow jetstream to create new consumer we
+			// will be reading records from the start from the stream.
+		}, nats.Durable(conn.consumer), nats.ManualAck(), nats.AckWait(ackwait))
+	}
+	if err := conn.Resume(); err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+	conn.logger.Info("unsubscribing and closing connection...")
+	if err := conn.Pause(); err != nil {
+		conn.logger.Error("error while unsubscribing", zap.Error(err))
+	}
+
+	return nil
+}
+
+// ensureConsumer creates the durable push consumer if it does not exist yet
+func (conn *jetstreamConnector) ensureConsumer(ackwait time.Duration) error {
+	stream, err := conn.jsContext.StreamNameBySubject(conn.connectordata.Topic)
+	if err != nil {
+		return fmt.Errorf("error occurred while looking up stream for topic: %w", err)
+	}
+
+	_, err = conn.jsContext.ConsumerInfo(stream, conn.consumer)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, nats.ErrConsumerNotFound) {
+		return fmt.Errorf("error occurred while looking up consumer: %w", err)
+	}
+
+	_, err = conn.jsContext.AddConsumer(stream, &nats.ConsumerConfig{
+		Durable:        conn.consumer,
+		DeliverSubject: conn.nc.NewInbox(),
+		DeliverPolicy:  nats.DeliverAllPolicy,
+		AckPolicy:      nats.AckExplicitPolicy,
+		AckWait:        ackwait,
+		FilterSubject:  conn.connectordata.Topic,
+	})
+	if err != nil {
+		return fmt.Errorf("error occurred while creating consumer: %w", err)
+	}
+	return nil
+}
+
+// Pause unsubscribes from the consumer, messages already delivered are still handled
+func (conn *jetstreamConnector) Pause() error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.sub == nil {
+		return nil
+	}
+	err := conn.sub.Unsubscribe()
+	conn.sub = nil
+	return err
+}
+
+// Resume subscribes to the consumer again
+func (conn *jetstreamConnector) Resume() error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.sub != nil {
+		return nil
+	}
+	sub, err := conn.subscribe()
+	if err != nil {
+		return fmt.Errorf("error occurred while subscribing to topic: %w", err)
+	}
+	conn.sub = sub
+	return nil
+}
+
+// subjectHeaders returns the headers sent to the function with every message
+func subjectHeaders(connectordata common.ConnectorMetadata) http.Header {
+	return http.Header{
+		"Topic":        {connectordata.Topic},
+		"RespTopic":    {connectordata.ResponseTopic},
+		"ErrorTopic":   {connectordata.ErrorTopic},
+		"Content-Type": {connectordata.ContentType},
+		"Source-Name":  {connectordata.SourceName},
+	}
+}
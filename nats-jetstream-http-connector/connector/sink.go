@@ -0,0 +1,53 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+func init() {
+	common.RegisterSink("nats", newJetstreamSinkFromURL)
+}
+
+// jetstreamSink publishes messages to the subject named by the message topic
+type jetstreamSink struct {
+	jsContext nats.JetStreamContext
+	// nc is set when the sink created its own connection and has to close it
+	nc *nats.Conn
+}
+
+// newJetstreamSinkFromURL creates a sink from a NATS server URL such as nats://host:4222
+func newJetstreamSinkFromURL(_ context.Context, u *url.URL, _ common.ConnectorMetadata, _ *zap.Logger) (common.Sink, error) {
+	nc, err := nats.Connect(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("error while connecting to NATS: %w", err)
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("error while getting jetstream context: %w", err)
+	}
+	return &jetstreamSink{jsContext: js, nc: nc}, nil
+}
+
+func (s *jetstreamSink) Publish(ctx context.Context, msg common.SinkMessage) error {
+	_, err := s.jsContext.PublishMsg(&nats.Msg{
+		Subject: msg.Topic,
+		Header:  nats.Header(msg.Headers),
+		Data:    msg.Body,
+	}, nats.Context(ctx))
+	return err
+}
+
+func (s *jetstreamSink) Close() error {
+	if s.nc != nil {
+		s.nc.Close()
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/stan.go"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+type natsConnector struct {
+	host           string
+	connectordata  common.ConnectorMetadata
+	stanConnection stan.Conn
+	logger         *zap.Logger
+
+	ctx     context.Context
+	handler common.MessageHandler
+	headers http.Header
+	mu      sync.Mutex
+	sub     stan.Subscription
+}
+
+// natsMessage is a message received from the subscription
+type natsMessage struct {
+	msg     *stan.Msg
+	headers http.Header
+}
+
+func (m *natsMessage) Body() []byte         { return m.msg.Data }
+func (m *natsMessage) Headers() http.Header { return m.headers }
+func (m *natsMessage) Key() string          { return "" }
+
+// Position returns the subject and the sequence number of the message
+func (m *natsMessage) Position() map[string]string {
+	return map[string]string{
+		"subject":  m.msg.Subject,
+		"sequence": strconv.FormatUint(m.msg.Sequence, 10),
+	}
+}
+
+// Ack acknowledges the message
+func (m *natsMessage) Ack() error {
+	return m.msg.Ack()
+}
+
+// Nack leaves the message unacknowledged, the server redelivers it once the ack wait expires
+func (m *natsMessage) Nack() error {
+	return nil
+}
+
+// Consume subscribes to the subject with the queue group until ctx is cancelled
+func (conn *natsConnector) Consume(ctx context.Context, handler common.MessageHandler) error {
+	conn.ctx = ctx
+	conn.handler = handler
+	conn.headers = subjectHeaders(conn.connectordata)
+	if err := conn.subscribe(); err != nil {
+		return err
+	}
+
+	conn.logger.Info("NATs consumer up and running!...")
+
+	// Run cleanup when the connector is stopped
+	<-ctx.Done()
+	conn.logger.Info("Received an interrupt, unsubscribing and closing connection...")
+	conn.mu.Lock()
+	if conn.sub != nil {
+		if err := conn.sub.Unsubscribe(); err != nil {
+			conn.logger.Error("error occurred while unsubscribing", zap.Error(err))
+		}
+		conn.sub = nil
+	}
+	conn.mu.Unlock()
+	if err := conn.stanConnection.Close(); err != nil {
+		conn.logger.Error("error occurred while closing connection", zap.Error(err))
+	}
+	return nil
+}
+
+func (conn *natsConnector) subscribe() error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	sub, err := conn.stanConnection.QueueSubscribe(conn.connectordata.Topic, os.Getenv("QUEUE_GROUP"), func(m *stan.Msg) {
+		conn.logger.Debug("message received",
+			zap.String("subject", m.Subject),
+			zap.Uint64("sequence", m.Sequence),
+			common.PayloadField("message", m.Data))
+		conn.handler(conn.ctx, &natsMessage{msg: m, headers: conn.headers.Clone()})
+	}, stan.DurableName(os.Getenv("DURABLE_NAME")), stan.DeliverAllAvailable(),
+		stan.SetManualAckMode(), stan.MaxInflight(1))
+
+	if err != nil {
+		return fmt.Errorf("error occurred while consuming message: %w", err)
+	}
+	conn.sub = sub
+	return nil
+}
+
+// Pause closes the subscription, the durable subscription is kept by the server
+func (conn *natsConnector) Pause() error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.sub == nil {
+		return nil
+	}
+	err := conn.sub.Close()
+	conn.sub = nil
+	return err
+}
+
+// Resume subscribes again, delivery continues from the durable subscription
+func (conn *natsConnector) Resume() error {
+	return conn.subscribe()
+}
+
+// Command runs the NATS Streaming connector
+var Command = common.Command{
+	Name:        "nats-streaming",
+	Description: "Subscribe to a NATS Streaming subject and post messages to an HTTP endpoint",
+	Run:         Run,
+	Headers:     subjectHeaders,
+}
+
+// Run subscribes to the configured subject until ctx is cancelled
+func Run(ctx context.Context, logger *zap.Logger, connectordata common.ConnectorMetadata) error {
+	host := os.Getenv("NATS_SERVER")
+
+	if host == "" {
+		return errors.New("received empty host field")
+	}
+
+	nc, err := nats.Connect(host)
+
+	if err != nil {
+		return fmt.Errorf("failed to establish connection with NATS: %w", err)
+	}
+	defer nc.Close()
+
+	clientId := xid.New()
+	sc, err := stan.Connect(os.Getenv("CLUSTER_ID"), clientId.String(), stan.NatsConn(nc))
+	if err != nil {
+		return fmt.Errorf("failed to establish connection with NATS Streaming: %w", err)
+	}
+
+	pipeline, err := common.NewPipeline(ctx, logger, connectordata, &natsSink{stanConnection: sc})
+	if err != nil {
+		return err
+	}
+	defer pipeline.Close()
+
+	conn := &natsConnector{
+		host:           host,
+		stanConnection: sc,
+		connectordata:  connectordata,
+		logger:         logger,
+	}
+	common.RegisterPausable(conn)
+	return conn.Consume(ctx, pipeline.Handle)
+}
+
+// subjectHeaders returns the headers sent to the function with every message
+func subjectHeaders(connectordata common.ConnectorMetadata) http.Header {
+	return http.Header{
+		"Topic":        {connectordata.Topic},
+		"RespTopic":    {connectordata.ResponseTopic},
+		"ErrorTopic":   {connectordata.ErrorTopic},
+		"Content-Type": {connectordata.ContentType},
+		"Source-Name":  {connectordata.SourceName},
+	}
+}
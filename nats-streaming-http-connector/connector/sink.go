@@ -0,0 +1,59 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/stan.go"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+func init() {
+	common.RegisterSink("stan", newNATSSinkFromURL)
+}
+
+// natsSink publishes messages to the subject named by the message topic, headers are not
+// supported by NATS Streaming and are dropped
+type natsSink struct {
+	stanConnection stan.Conn
+	// nc is set when the sink created its own connection and has to close it
+	nc *nats.Conn
+}
+
+// newNATSSinkFromURL creates a sink from a URL of the form stan://host:4222?cluster_id=<cluster>
+func newNATSSinkFromURL(_ context.Context, u *url.URL, _ common.ConnectorMetadata, _ *zap.Logger) (common.Sink, error) {
+	clusterID := u.Query().Get("cluster_id")
+	if clusterID == "" {
+		return nil, errors.New("no cluster_id given in nats streaming sink url")
+	}
+
+	server := url.URL{Scheme: "nats", User: u.User, Host: u.Host}
+	nc, err := nats.Connect(server.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to establish connection with NATS: %w", err)
+	}
+	sc, err := stan.Connect(clusterID, xid.New().String(), stan.NatsConn(nc))
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("failed to establish connection with NATS Streaming: %w", err)
+	}
+	return &natsSink{stanConnection: sc, nc: nc}, nil
+}
+
+func (s *natsSink) Publish(_ context.Context, msg common.SinkMessage) error {
+	return s.stanConnection.Publish(msg.Topic, msg.Body)
+}
+
+func (s *natsSink) Close() error {
+	if s.nc == nil {
+		return nil
+	}
+	defer s.nc.Close()
+	return s.stanConnection.Close()
+}
@@ -0,0 +1,194 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+type rabbitMQConnector struct {
+	host            string
+	connectordata   common.ConnectorMetadata
+	consumerChannel *amqp.Channel
+	replies         *rabbitMQSink
+	logger          *zap.Logger
+	// consumerTag identifies the consumer so that it can be cancelled on pause
+	consumerTag string
+
+	ctx     context.Context
+	handler common.MessageHandler
+	headers http.Header
+	sem     chan int
+}
+
+// rabbitMQMessage is a delivery received from the queue
+type rabbitMQMessage struct {
+	delivery amqp.Delivery
+	headers  http.Header
+	// replies publishes the replies to the ReplyTo queue of the delivery
+	replies *rabbitMQSink
+}
+
+func (m *rabbitMQMessage) Body() []byte         { return m.delivery.Body }
+func (m *rabbitMQMessage) Headers() http.Header { return m.headers }
+func (m *rabbitMQMessage) Key() string          { return "" }
+
+// Position returns the exchange, routing key and delivery tag of the delivery
+func (m *rabbitMQMessage) Position() map[string]string {
+	return map[string]string{
+		"exchange":    m.delivery.Exchange,
+		"routingKey":  m.delivery.RoutingKey,
+		"deliveryTag": strconv.FormatUint(m.delivery.DeliveryTag, 10),
+	}
+}
+
+// ReplyTo returns the queue the sender expects the reply on
+func (m *rabbitMQMessage) ReplyTo() string {
+	return m.delivery.ReplyTo
+}
+
+// Reply publishes body to the ReplyTo queue with the correlation id of the delivery
+func (m *rabbitMQMessage) Reply(ctx context.Context, body []byte, headers http.Header) error {
+	return m.replies.publish(ctx, m.delivery.ReplyTo, m.delivery.CorrelationId, body, headers)
+}
+
+// Ack acknowledges the delivery
+func (m *rabbitMQMessage) Ack() error {
+	return m.delivery.Ack(false)
+}
+
+// Nack leaves the delivery unacknowledged, the broker redelivers it once the consumer channel is closed
+func (m *rabbitMQMessage) Nack() error {
+	return nil
+}
+
+// Consume consumes deliveries from the queue until ctx is cancelled
+func (conn *rabbitMQConnector) Consume(ctx context.Context, handler common.MessageHandler) error {
+	conn.headers = common.KEDAHeaders(conn.connectordata)
+	conn.ctx = ctx
+	conn.handler = handler
+
+	concurrent := 0
+	var err error
+	if os.Getenv("CONCURRENT") == "" {
+		concurrent = 10 // Set concurrent to 10 when env not exist
+	} else {
+		concurrent, err = strconv.Atoi(os.Getenv("CONCURRENT")) // The env will be str by default, convert it to int
+		if err != nil {
+			// Whenn error happened, use the default concurrent
+			concurrent = 10
+		}
+	}
+	conn.sem = make(chan int, concurrent) // Process messages concurrently
+
+	if err := conn.consume(); err != nil {
+		return err
+	}
+
+	conn.logger.Info("RabbitMQ consumer up and running!...")
+	<-ctx.Done()
+	return nil
+}
+
+// consume starts a consumer on the queue and handles its deliveries until it is cancelled
+func (conn *rabbitMQConnector) consume() error {
+	msgs, err := conn.consumerChannel.Consume(
+		conn.connectordata.Topic, // queue
+		conn.consumerTag,         // consumer
+		false,                    // auto-ack
+		false,                    // exclusive
+		false,                    // no-local
+		false,                    // no-wait
+		nil,                      // args
+	)
+
+	if err != nil {
+		return fmt.Errorf("error occurred while consuming message: %w", err)
+	}
+
+	go func() {
+		for d := range msgs {
+			conn.sem <- 1
+			go func(d amqp.Delivery) {
+				conn.handler(conn.ctx, &rabbitMQMessage{delivery: d, headers: conn.headers.Clone(), replies: conn.replies})
+				<-conn.sem
+			}(d)
+		}
+	}()
+	return nil
+}
+
+// Pause cancels the consumer, deliveries already received are still handled
+func (conn *rabbitMQConnector) Pause() error {
+	return conn.consumerChannel.Cancel(conn.consumerTag, false)
+}
+
+// Resume starts a new consumer on the queue
+func (conn *rabbitMQConnector) Resume() error {
+	return conn.consume()
+}
+
+// Command runs the RabbitMQ connector
+var Command = common.Command{
+	Name:        "rabbitmq",
+	Description: "Consume messages from a RabbitMQ queue and post them to an HTTP endpoint",
+	Run:         Run,
+	Headers:     common.KEDAHeaders,
+}
+
+// Run consumes messages from the configured queue until ctx is cancelled
+func Run(ctx context.Context, logger *zap.Logger, connectordata common.ConnectorMetadata) error {
+	host := os.Getenv("HOST")
+	if os.Getenv("INCLUDE_UNACKED") == "true" {
+		return errors.New("only amqp protocol host is supported")
+	}
+	if host == "" {
+		return errors.New("received empty host field")
+	}
+
+	connection, err := amqp.Dial(host)
+	if err != nil {
+		return fmt.Errorf("failed to establish connection with RabbitMQ: %w", err)
+	}
+	defer connection.Close()
+
+	producerChannel, err := connection.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open RabbitMQ channel for producer: %w", err)
+	}
+	defer producerChannel.Close()
+
+	consumerChannel, err := connection.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open RabbitMQ channel for consumer: %w", err)
+	}
+	defer consumerChannel.Close()
+
+	sink := &rabbitMQSink{channel: producerChannel, contentType: connectordata.ContentType, connection: connection}
+	pipeline, err := common.NewPipeline(ctx, logger, connectordata, sink)
+	if err != nil {
+		return err
+	}
+	defer pipeline.Close()
+	defer sink.Close()
+
+	conn := rabbitMQConnector{
+		host:            host,
+		connectordata:   connectordata,
+		consumerChannel: consumerChannel,
+		replies:         sink,
+		logger:          logger,
+		consumerTag:     "keda-connector-" + xid.New().String(),
+	}
+	common.RegisterPausable(&conn)
+	return conn.Consume(ctx, pipeline.Handle)
+}
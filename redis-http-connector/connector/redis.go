@@ -0,0 +1,138 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+// popTimeout bounds how long BLPop blocks on an empty list
+const popTimeout = 5 * time.Second
+
+type redisConnector struct {
+	// PauseGate stops popping from the list while the connector is paused
+	common.PauseGate
+	rdbConnection *redis.Client
+	connectordata common.ConnectorMetadata
+	logger        *zap.Logger
+}
+
+// redisMessage is an element popped from the list
+type redisMessage struct {
+	body    string
+	headers http.Header
+}
+
+func (m *redisMessage) Body() []byte         { return []byte(m.body) }
+func (m *redisMessage) Headers() http.Header { return m.headers }
+func (m *redisMessage) Key() string          { return "" }
+
+// Ack is a no-op, the element has already been removed from the list by BLPop
+func (m *redisMessage) Ack() error {
+	return nil
+}
+
+// Nack is a no-op, the element has already been removed from the list by BLPop
+func (m *redisMessage) Nack() error {
+	return nil
+}
+
+// Consume pops elements from the list until ctx is cancelled or popping fails
+func (conn *redisConnector) Consume(ctx context.Context, handler common.MessageHandler) error {
+	headers := common.KEDAHeaders(conn.connectordata)
+
+	for {
+		// Check if the context is done, block while the connector is paused
+		if err := conn.Wait(ctx); err != nil {
+			return err
+		}
+		// BLPop will block and wait for a new message if the list is empty, the timeout
+		// lets a pause take effect while the list is empty
+		msg, err := conn.rdbConnection.BLPop(ctx, popTimeout, conn.connectordata.Topic).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error in consuming queue: %w", err)
+		}
+
+		if len(msg) > 1 {
+			// BLPop returns a slice with topic and message, we need the second item
+			handler(ctx, &redisMessage{body: msg[1], headers: headers.Clone()})
+		}
+	}
+}
+
+func (conn *redisConnector) close() error {
+	return conn.rdbConnection.Close()
+}
+
+// Command runs the Redis connector
+var Command = common.Command{
+	Name:        "redis",
+	Description: "Pop messages from a Redis list and post them to an HTTP endpoint",
+	Run:         Run,
+	Headers:     common.KEDAHeaders,
+}
+
+// Run pops messages from the configured list until ctx is cancelled
+func Run(ctx context.Context, logger *zap.Logger, connectordata common.ConnectorMetadata) error {
+	address := os.Getenv("ADDRESS")
+	if address == "" {
+		return errors.New("empty address field")
+	}
+	password := os.Getenv("PASSWORD_FROM_ENV")
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     address,
+		Password: password,
+	})
+
+	sink := &redisSink{rdbConnection: rdb}
+	pipeline, err := common.NewPipeline(ctx, logger, connectordata, sink)
+	if err != nil {
+		return err
+	}
+	defer pipeline.Close()
+
+	wg := sync.WaitGroup{}
+	conn := redisConnector{
+		rdbConnection: rdb,
+		connectordata: connectordata,
+		logger:        logger,
+	}
+	common.RegisterPausable(&conn)
+	defer func() {
+		if err := conn.close(); err != nil {
+			logger.Error("Error closing Redis connection", zap.Error(err))
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			if err := conn.Consume(ctx, pipeline.Handle); err != nil {
+				if ctx.Err() != nil {
+					conn.logger.Info("Context cancelled, stopping consumer")
+					return
+				}
+				logger.Error("Error in consuming message", zap.Error(err))
+			}
+			// Remove the context check here, as it's now handled in Consume
+			conn.logger.Info("Restarting consumer")
+		}
+	}()
+	wg.Wait()
+	logger.Info("Terminating: Redis consumer")
+	return nil
+}
@@ -0,0 +1,54 @@
+package connector
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	"github.com/fission/keda-connectors/common"
+)
+
+func init() {
+	common.RegisterSink("redis", newRedisSinkFromURL)
+	common.RegisterSink("rediss", newRedisSinkFromURL)
+}
+
+// redisSink pushes messages to the tail of the list named by the message topic
+type redisSink struct {
+	rdbConnection *redis.Client
+	// owned is set when the sink created the client and has to close it
+	owned bool
+}
+
+// newRedisSinkFromURL creates a sink from a URL such as redis://:password@host:6379/0
+func newRedisSinkFromURL(_ context.Context, u *url.URL, _ common.ConnectorMetadata, _ *zap.Logger) (common.Sink, error) {
+	options, err := redis.ParseURL(u.String())
+	if err != nil {
+		return nil, err
+	}
+	return &redisSink{rdbConnection: redis.NewClient(options), owned: true}, nil
+}
+
+func (s *redisSink) Publish(ctx context.Context, msg common.SinkMessage) error {
+	return s.rdbConnection.RPush(ctx, msg.Topic, msg.Body).Err()
+}
+
+// PublishBatch pushes all messages in a MULTI/EXEC transaction
+func (s *redisSink) PublishBatch(ctx context.Context, msgs []common.SinkMessage) error {
+	_, err := s.rdbConnection.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, msg := range msgs {
+			pipe.RPush(ctx, msg.Topic, msg.Body)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *redisSink) Close() error {
+	if !s.owned {
+		return nil
+	}
+	return s.rdbConnection.Close()
+}